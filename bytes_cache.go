@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"github.com/alaingilbert/cache/internal/arena"
+	"github.com/alaingilbert/cache/internal/mtx"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"hash/maphash"
+	"time"
+)
+
+// DefaultBytesCacheSize is the number of bytes allocated by a BytesCache unless MaxCost is used
+var DefaultBytesCacheSize int64 = 64 << 20
+
+// DefaultBytesCacheShards is the number of shards of a BytesCache unless Shards is used
+var DefaultBytesCacheShards = 16
+
+// ErrEntryTooLarge is returned when an entry does not fit in a shard of a BytesCache
+var ErrEntryTooLarge = arena.ErrEntryTooLarge
+
+// BytesCache is a cache of []byte values that keeps its entries in large pre-allocated ring buffers,
+// indexed by hashmaps that hold no pointers, so that millions of entries do not slow down the garbage collector.
+// The total size of the buffers is given by MaxCost, it is split between the shards. Once a shard is full,
+// its oldest entries are overwritten. The space of the replaced, deleted and expired entries is only
+// reclaimed when it is overwritten.
+type BytesCache struct {
+	ctx               context.Context          // Context is used to stop the auto-cleanup thread
+	cancel            context.CancelFunc       // Cancel the context and stop the auto-cleanup thread
+	defaultExpiration time.Duration            // Default expiration for items in cache
+	clock             clockwork.Clock          // Clock object for time related features
+	shards            []mtx.RWMtx[*arena.Ring] // Entries of the cache, split by the hash of their key
+	seed              maphash.Seed             // Seed of the hash of the keys
+	janitor           *Janitor                 // Shared janitor running the cleanup cycles, nil if the cache has its own goroutine
+	janitorID         uint64                   // Id of the cache in its janitor
+	cleanupEventsCh   chan struct{}            // Notifies that a cleanup cycle has been completed (for tests)
+}
+
+// NewBytesCache creates a cache of []byte values. The options WithContext, CleanupInterval, WithClock,
+// WithJanitor, Shards and MaxCost (the size of the buffers in bytes) are supported, the others are ignored.
+func NewBytesCache(defaultExpiration time.Duration, opts ...Option) *BytesCache {
+	cfg := utils.BuildConfig(opts)
+	cfg.ctx = utils.Or(cfg.ctx, context.Background())
+	cfg.clock = utils.Or(cfg.clock, clockwork.NewRealClock())
+	cleanupInterval := utils.Default(cfg.cleanupInterval, DefaultCleanupInterval)
+	c := new(BytesCache)
+	c.ctx, c.cancel = context.WithCancel(cfg.ctx)
+	c.clock = cfg.clock
+	c.defaultExpiration = defaultExpiration
+	n := shardCount(utils.Or(cfg.shards, DefaultBytesCacheShards))
+	size := splitCapacity(utils.Or(cfg.maxCost, DefaultBytesCacheSize), n)
+	c.seed = maphash.MakeSeed()
+	c.shards = make([]mtx.RWMtx[*arena.Ring], n)
+	for i := range c.shards {
+		c.shards[i] = mtx.NewRWMtx(arena.NewRing(int(size)))
+	}
+	c.cleanupEventsCh = make(chan struct{})
+	if cfg.janitor != nil {
+		c.janitor = cfg.janitor
+		c.janitorID = c.janitor.register(func() bool {
+			if c.ctx.Err() != nil {
+				return false
+			}
+			c.deleteExpired()
+			return true
+		})
+	} else if cleanupInterval > 0 {
+		go c.autoCleanup(cleanupInterval)
+	}
+	return c
+}
+
+// Destroy the cache object, cleanup all resources
+func (c *BytesCache) Destroy() {
+	c.cancel()
+	if c.janitor != nil {
+		c.janitor.deregister(c.janitorID)
+	}
+	c.DeleteAll()
+}
+
+// Has returns either or not the key is present in the cache
+func (c *BytesCache) Has(k string) bool {
+	return utils.Second(c.Get(k))
+}
+
+// Get returns a copy of the value associated to the given key
+func (c *BytesCache) Get(k string) (value []byte, found bool) {
+	value, _, found = c.GetWithExpiration(k)
+	return
+}
+
+// GetWithExpiration gets a copy of a value and its expiration time from the cache.
+// If the item never expires a zero value for time.Time is returned.
+func (c *BytesCache) GetWithExpiration(k string) (value []byte, expiration time.Time, found bool) {
+	hash := maphash.String(c.seed, k)
+	var item Item[[]byte]
+	c.shard(hash).RWith(func(r *arena.Ring) {
+		item.value, item.expiration, found = r.Get(hash, []byte(k))
+	})
+	if !found || item.isExpired(c.clock.Now().UnixNano()) {
+		return nil, time.Time{}, false
+	}
+	return item.value, item.expirationTime(), true
+}
+
+// Set a key/value pair in the cache, the value is copied. Only the expiration options are supported.
+// Returns ErrEntryTooLarge if the entry does not fit in a shard.
+func (c *BytesCache) Set(k string, v []byte, opts ...ItemOption) error {
+	cfg := &ItemConfig{clock: c.clock}
+	utils.ApplyOptions(cfg, opts)
+	var item Item[[]byte]
+	item.setTTL(c.clock.Now().UnixNano(), utils.Or(cfg.d, c.defaultExpiration), false)
+	hash := maphash.String(c.seed, k)
+	return c.shard(hash).WithE(func(r **arena.Ring) error {
+		return (*r).Set(hash, []byte(k), v, item.expiration)
+	})
+}
+
+// Delete an item from the cache
+func (c *BytesCache) Delete(k string) {
+	hash := maphash.String(c.seed, k)
+	c.shard(hash).With(func(r **arena.Ring) {
+		(*r).Delete(hash, []byte(k))
+	})
+}
+
+// DeleteExpired deletes all expired items from the cache
+func (c *BytesCache) DeleteExpired() {
+	c.deleteExpired()
+}
+
+// DeleteAll deletes all items from the cache
+func (c *BytesCache) DeleteAll() {
+	for i := range c.shards {
+		c.shards[i].With(func(r **arena.Ring) { (*r).Clear() })
+	}
+}
+
+// Len returns the number of items in the cache. This may include items that have
+// expired, but have not yet been cleaned up.
+func (c *BytesCache) Len() (out int) {
+	for i := range c.shards {
+		c.shards[i].RWith(func(r *arena.Ring) { out += r.Len() })
+	}
+	return out
+}
+
+func (c *BytesCache) shard(hash uint64) *mtx.RWMtx[*arena.Ring] {
+	return &c.shards[hash&uint64(len(c.shards)-1)]
+}
+
+func (c *BytesCache) autoCleanup(cleanupInterval time.Duration) {
+	for {
+		select {
+		case <-c.clock.After(cleanupInterval):
+		case <-c.ctx.Done():
+			return
+		}
+		c.deleteExpired()
+		select {
+		case c.cleanupEventsCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *BytesCache) deleteExpired() {
+	now := c.clock.Now().UnixNano()
+	for i := range c.shards {
+		c.shards[i].With(func(r **arena.Ring) { (*r).DeleteExpired(now) })
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBytesCache(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := NewBytesCache(time.Minute, WithClock(clock), MaxCost(1<<20))
+	defer c.Destroy()
+	assert.NoError(t, c.Set("key1", []byte("val1")))
+	assert.NoError(t, c.Set("key2", []byte("val2"), NoExpire))
+	assert.NoError(t, c.Set("key3", []byte("val3"), ExpireIn(time.Hour)))
+	assert.Equal(t, 3, c.Len())
+	value, found := c.Get("key1")
+	assert.True(t, found)
+	assert.Equal(t, []byte("val1"), value)
+	_, expiration, _ := c.GetWithExpiration("key2")
+	assert.True(t, expiration.IsZero())
+	_, expiration, _ = c.GetWithExpiration("key3")
+	assert.Equal(t, clock.Now().Add(time.Hour).UnixNano(), expiration.UnixNano())
+	assert.False(t, c.Has("key4"))
+
+	clock.Advance(2 * time.Minute)
+	assert.False(t, c.Has("key1"))
+	assert.True(t, c.Has("key2"))
+	assert.Equal(t, 3, c.Len())
+	c.DeleteExpired()
+	assert.Equal(t, 2, c.Len())
+
+	c.Delete("key2")
+	assert.False(t, c.Has("key2"))
+	c.DeleteAll()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestBytesCacheCopy(t *testing.T) {
+	c := NewBytesCache(time.Minute)
+	defer c.Destroy()
+	v := []byte("val1")
+	assert.NoError(t, c.Set("key1", v))
+	v[0] = 'x'
+	value, _ := c.Get("key1")
+	assert.Equal(t, []byte("val1"), value)
+	value[0] = 'y'
+	value, _ = c.Get("key1")
+	assert.Equal(t, []byte("val1"), value)
+}
+
+func TestBytesCacheFull(t *testing.T) {
+	c := NewBytesCache(time.Minute, Shards(1), MaxCost(1024))
+	defer c.Destroy()
+	assert.ErrorIs(t, c.Set("key", make([]byte, 2048)), ErrEntryTooLarge)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, c.Set(fmt.Sprintf("key%d", i), make([]byte, 100)))
+	}
+	assert.Less(t, c.Len(), 10)
+	assert.True(t, c.Has("key99"))
+	assert.False(t, c.Has("key0"))
+}
+
+func TestBytesCacheAutoClean(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := NewBytesCache(time.Minute, WithClock(clock))
+	defer c.Destroy()
+	clock.BlockUntil(1)
+	assert.NoError(t, c.Set("key1", []byte("val1")))
+	clock.Advance(11 * time.Minute)
+	<-c.cleanupEventsCh
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestBytesCacheConcurrent(t *testing.T) {
+	c := NewBytesCache(time.Minute, MaxCost(1<<16))
+	defer c.Destroy()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprintf("key%d", i)
+				_ = c.Set(k, []byte(k))
+				if value, found := c.Get(k); found {
+					assert.Equal(t, k, string(value))
+				}
+				c.Delete(fmt.Sprintf("key%d", i/2))
+			}
+		}()
+	}
+	wg.Wait()
+}
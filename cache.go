@@ -3,9 +3,13 @@ package cache
 import (
 	"context"
 	"errors"
-	"github.com/alaingilbert/cache/internal/mtx"
+	"fmt"
+	"github.com/alaingilbert/cache/internal/singleflight"
 	"github.com/alaingilbert/cache/internal/utils"
 	"github.com/alaingilbert/clockwork"
+	"hash/maphash"
+	"reflect"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,20 +23,45 @@ const (
 // DefaultCleanupInterval is exported so that someone could override the value in their project
 var DefaultCleanupInterval = 10 * time.Minute
 
+// DefaultExpirationIndexThreshold is the number of items above which a cache builds its expiration index,
+// unless ExpirationIndex is used. It is exported so that someone could override the value in their project.
+var DefaultExpirationIndexThreshold = 100_000
+
 // ErrItemAlreadyExists ...
 var ErrItemAlreadyExists = errors.New("item already exists")
 
 // ErrItemNotFound ...
 var ErrItemNotFound = errors.New("item does not exists")
 
+// ErrVersionMismatch ...
+var ErrVersionMismatch = errors.New("item version mismatch")
+
 // Cache ...
 type Cache[K comparable, V any] struct {
-	ctx               context.Context          // Context is used to stop the auto-cleanup thread
-	cancel            context.CancelFunc       // Cancel the context and stop the auto-cleanup thread
-	defaultExpiration time.Duration            // Default expiration for items in cache
-	clock             clockwork.Clock          // Clock object for time related features
-	items             mtx.RWMtxMap[K, Item[V]] // Mutex protected hashmap that contains all items in the cache
-	cleanupEventsCh   chan struct{}            // Notifies that a cleanup cycle has been completed (for tests)
+	ctx               context.Context                // Context is used to stop the auto-cleanup thread
+	cancel            context.CancelFunc             // Cancel the context and stop the auto-cleanup thread
+	defaultExpiration time.Duration                  // Default expiration for items in cache
+	clock             clockwork.Clock                // Clock object for time related features
+	shards            []*shard[K, V]                 // Items of the cache, split by the hash of their key
+	seed              maphash.Seed                   // Seed of the hash that chooses the shard of a key
+	versions          atomic.Uint64                  // Last version given to an item
+	weigher           func(K, V) int64               // Computes the cost of an item, nil means every item costs 1
+	onEvicted         func(K, V, EvictionReason)     // Called when an item leaves the cache
+	loads             singleflight.Group[K, Item[V]] // Collapses concurrent loads of the same key
+	loader            Loader[K, V]                   // Loads the missing keys on Get, nil if the cache does not load
+	refreshAfter      time.Duration                  // Age after which an item is reloaded in the background (0 means never)
+	defaultSliding    time.Duration                  // Default sliding expiration for items in cache (0 means none)
+	stats             *statsRecorder                 // Statistics recorder, nil if statistics are disabled
+	keyCodec          Codec[K]                       // Encodes the keys when the cache is saved
+	valueCodec        Codec[V]                       // Encodes the values when the cache is saved
+	expiryThreshold   int                            // Number of items above which the expiration index is built (-1 means never)
+	cleanupBatchSize  int                            // Maximum number of items checked by the auto-cleanup per lock hold (0 means unbounded)
+	cleanupBatchTime  time.Duration                  // Maximum duration of the auto-cleanup per lock hold (0 means unbounded)
+	adaptiveCleanup   bool                           // The auto-cleanup samples random items instead of checking them all
+	janitor           *Janitor                       // Shared janitor running the cleanup cycles, nil if the cache has its own goroutine
+	janitorID         uint64                         // Id of the cache in its janitor
+	overflow          *DiskTier[K, V]                // Tier that receives the items evicted for capacity reasons, nil if none
+	cleanupEventsCh   chan struct{}                  // Notifies that a cleanup cycle has been completed (for tests)
 }
 
 // Config ...
@@ -40,6 +69,27 @@ type Config struct {
 	ctx             context.Context
 	cleanupInterval *time.Duration
 	clock           clockwork.Clock
+	maxItems        int
+	maxCost         int64
+	weigher         any
+	onEvicted       any
+	loader          any
+	refreshAfter    time.Duration
+	recordStats     bool
+	defaultSliding  time.Duration
+	keyCodec        any
+	valueCodec      any
+	policy          Policy
+	expirationIndex *bool
+	cleanupBatch    int
+	cleanupTime     time.Duration
+	adaptiveCleanup bool
+	janitor         *Janitor
+	shards          int
+	store           any
+	overflow        any
+	segmentSize     int64
+	onDiskError     func(error)
 }
 
 // WithContext ...
@@ -66,6 +116,139 @@ func (c *Config) WithClock(clock clockwork.Clock) *Config {
 	return c
 }
 
+// MaxItems ...
+func (c *Config) MaxItems(n int) *Config {
+	if n > 0 {
+		c.maxItems = n
+	}
+	return c
+}
+
+// MaxCost ...
+func (c *Config) MaxCost(n int64) *Config {
+	if n > 0 {
+		c.maxCost = n
+	}
+	return c
+}
+
+// Weigher ...
+func (c *Config) Weigher(fn any) *Config {
+	c.weigher = fn
+	return c
+}
+
+// OnEvicted ...
+func (c *Config) OnEvicted(fn any) *Config {
+	c.onEvicted = fn
+	return c
+}
+
+// Loader ...
+func (c *Config) Loader(l any) *Config {
+	c.loader = l
+	return c
+}
+
+// RefreshAfter ...
+func (c *Config) RefreshAfter(d time.Duration) *Config {
+	if d > 0 {
+		c.refreshAfter = d
+	}
+	return c
+}
+
+// SlidingExpiration ...
+func (c *Config) SlidingExpiration(d time.Duration) *Config {
+	if d > 0 {
+		c.defaultSliding = d
+	}
+	return c
+}
+
+// RecordStats ...
+func (c *Config) RecordStats(enabled bool) *Config {
+	c.recordStats = enabled
+	return c
+}
+
+// KeyCodec ...
+func (c *Config) KeyCodec(codec any) *Config {
+	c.keyCodec = codec
+	return c
+}
+
+// ValueCodec ...
+func (c *Config) ValueCodec(codec any) *Config {
+	c.valueCodec = codec
+	return c
+}
+
+// EvictionPolicy ...
+func (c *Config) EvictionPolicy(p Policy) *Config {
+	c.policy = p
+	return c
+}
+
+// ExpirationIndex ...
+func (c *Config) ExpirationIndex(enabled bool) *Config {
+	c.expirationIndex = &enabled
+	return c
+}
+
+// CleanupBatch ...
+func (c *Config) CleanupBatch(maxItems int, maxTime time.Duration) *Config {
+	c.cleanupBatch = max(maxItems, 0)
+	c.cleanupTime = max(maxTime, 0)
+	return c
+}
+
+// AdaptiveCleanup ...
+func (c *Config) AdaptiveCleanup(enabled bool) *Config {
+	c.adaptiveCleanup = enabled
+	return c
+}
+
+// Janitor ...
+func (c *Config) Janitor(j *Janitor) *Config {
+	c.janitor = j
+	return c
+}
+
+// Shards ...
+func (c *Config) Shards(n int) *Config {
+	if n > 0 {
+		c.shards = n
+	}
+	return c
+}
+
+// Store ...
+func (c *Config) Store(newStore any) *Config {
+	c.store = newStore
+	return c
+}
+
+// Overflow ...
+func (c *Config) Overflow(tier any) *Config {
+	c.overflow = tier
+	return c
+}
+
+// SegmentSize ...
+func (c *Config) SegmentSize(n int64) *Config {
+	if n > 0 {
+		c.segmentSize = n
+	}
+	return c
+}
+
+// OnDiskError ...
+func (c *Config) OnDiskError(fn func(error)) *Config {
+	c.onDiskError = fn
+	return c
+}
+
 // Option ...
 type Option func(cfg *Config)
 
@@ -90,10 +273,176 @@ func WithClock(clock clockwork.Clock) Option {
 	}
 }
 
+// MaxItems bounds the number of items in the cache, an item is evicted according
+// to the eviction policy (LRU by default) when a new one is added to a full cache
+func MaxItems(n int) Option {
+	return func(cfg *Config) {
+		cfg = cfg.MaxItems(n)
+	}
+}
+
+// MaxCost bounds the total cost of the items in the cache, items are evicted according
+// to the eviction policy until the total cost fits. The cost of an item is given by WithCost,
+// or by the Weigher, and defaults to 1.
+func MaxCost(n int64) Option {
+	return func(cfg *Config) {
+		cfg = cfg.MaxCost(n)
+	}
+}
+
+// Weigher sets the function used to compute the cost of an item.
+// K and V must match the types of the cache, otherwise the cache creation panics.
+func Weigher[K comparable, V any](fn func(K, V) int64) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Weigher(fn)
+	}
+}
+
+// OnEvicted sets a function that is called with the reason every time an item leaves the cache.
+// It is called once the cache lock is released, so it can safely call back into the cache.
+// K and V must match the types of the cache, otherwise the cache creation panics.
+func OnEvicted[K comparable, V any](fn func(k K, v V, reason EvictionReason)) Option {
+	return func(cfg *Config) {
+		cfg = cfg.OnEvicted(fn)
+	}
+}
+
+// WithLoader sets the Loader used by Get and GetWithExpiration to load the missing keys.
+// K and V must match the types of the cache, otherwise the cache creation panics.
+func WithLoader[K comparable, V any](l Loader[K, V]) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Loader(l)
+	}
+}
+
+// RefreshAfter makes Get and GetWithExpiration reload an item in the background once it is older
+// than d but has not expired yet, the old value is served until the new one is loaded.
+// It requires a Loader.
+func RefreshAfter(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg = cfg.RefreshAfter(d)
+	}
+}
+
+// SlidingExpiration makes items expire after they have not been accessed for d, unless an expiration
+// is given when they are stored. It overrides the default expiration of the cache, see Sliding.
+func SlidingExpiration(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg = cfg.SlidingExpiration(d)
+	}
+}
+
+// RecordStats enables the statistics of the cache, see Cache.Stats
+func RecordStats(cfg *Config) {
+	cfg = cfg.RecordStats(true)
+}
+
+// KeyCodec sets the codec used to encode the keys when the cache is saved (GobCodec by default).
+// K must match the key type of the cache, otherwise the cache creation panics.
+func KeyCodec[K any](codec Codec[K]) Option {
+	return func(cfg *Config) {
+		cfg = cfg.KeyCodec(codec)
+	}
+}
+
+// ValueCodec sets the codec used to encode the values when the cache is saved (GobCodec by default).
+// V must match the value type of the cache, otherwise the cache creation panics.
+func ValueCodec[V any](codec Codec[V]) Option {
+	return func(cfg *Config) {
+		cfg = cfg.ValueCodec(codec)
+	}
+}
+
+// EvictionPolicy changes the algorithm used to choose which item to evict from a bounded cache
+func EvictionPolicy(p Policy) Option {
+	return func(cfg *Config) {
+		cfg = cfg.EvictionPolicy(p)
+	}
+}
+
+// ExpirationIndex forces the use of an index of the expiration timestamps, so that a cleanup only touches
+// the items that are due instead of scanning the whole cache. By default the index is built once the cache
+// holds more than DefaultExpirationIndexThreshold items, and ExpirationIndex(false) disables it.
+func ExpirationIndex(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg = cfg.ExpirationIndex(enabled)
+	}
+}
+
+// CleanupBatch makes the auto-cleanup delete the expired items in batches of at most maxItems checked items,
+// or lasting at most maxTime (0 means no limit). The cache lock is released between batches, so that reads
+// and writes do not wait for a whole cleanup cycle. The batches go through the expiration index once it is built,
+// and otherwise walk the store, each batch resuming where the previous one stopped. DeleteExpired is not affected.
+func CleanupBatch(maxItems int, maxTime time.Duration) Option {
+	return func(cfg *Config) {
+		cfg = cfg.CleanupBatch(maxItems, maxTime)
+	}
+}
+
+// AdaptiveCleanup makes the auto-cleanup check random samples of items instead of the whole cache, and keep
+// sampling while more than a quarter of the sampled items have expired, like Redis does.
+// The samples have the size given to CleanupBatch, or 20 items.
+func AdaptiveCleanup(cfg *Config) {
+	cfg = cfg.AdaptiveCleanup(true)
+}
+
+// WithJanitor makes the cache cleaned up by a shared janitor instead of its own goroutine,
+// the cleanup interval of the cache is ignored. The cache is removed from the janitor by Destroy.
+func WithJanitor(j *Janitor) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Janitor(j)
+	}
+}
+
+// Shards splits the items of the cache between n shards (rounded up to a power of two), each with its own lock,
+// to reduce the contention when many goroutines use the cache. The capacity given to MaxItems and MaxCost
+// is split evenly between the shards, and each shard evicts its own items.
+func Shards(n int) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Shards(n)
+	}
+}
+
+// WithStore changes where the items of the cache are kept, newStore is called once per shard (see Shards).
+// By default, the items are kept in a hashmap.
+// K and V must match the types of the cache, otherwise the cache creation panics.
+func WithStore[K comparable, V any](newStore func() Store[K, V]) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Store(newStore)
+	}
+}
+
+// Overflow makes the items evicted for capacity reasons spill to a disk tier instead of leaving the cache,
+// a Get that misses in memory checks the disk tier and moves the item back to memory. An item is never in both tiers.
+// Moving an item to disk is not an eviction, but the items that leave the disk tier are reported to OnEvicted and the stats.
+// Len, Items and Save only see the items in memory. K and V must match the types of the cache, otherwise the cache creation panics.
+func Overflow[K comparable, V any](tier *DiskTier[K, V]) Option {
+	return func(cfg *Config) {
+		cfg = cfg.Overflow(tier)
+	}
+}
+
+// SegmentSize sets the maximum size of a segment file of a DiskTier (DefaultSegmentSize by default)
+func SegmentSize(n int64) Option {
+	return func(cfg *Config) {
+		cfg = cfg.SegmentSize(n)
+	}
+}
+
+// OnDiskError sets a function that is called with the errors of a DiskTier that cannot be returned,
+// like the failure to spill an item. They are ignored by default.
+func OnDiskError(fn func(error)) Option {
+	return func(cfg *Config) {
+		cfg = cfg.OnDiskError(fn)
+	}
+}
+
 // ItemConfig ...
 type ItemConfig struct {
-	d     time.Duration
-	clock clockwork.Clock
+	d       time.Duration
+	sliding time.Duration
+	cost    int64
+	clock   clockwork.Clock
 }
 
 // Duration ...
@@ -102,6 +451,18 @@ func (c *ItemConfig) Duration(d time.Duration) *ItemConfig {
 	return c
 }
 
+// Sliding ...
+func (c *ItemConfig) Sliding(d time.Duration) *ItemConfig {
+	c.sliding = d
+	return c
+}
+
+// Cost ...
+func (c *ItemConfig) Cost(cost int64) *ItemConfig {
+	c.cost = cost
+	return c
+}
+
 // ItemOption ...
 type ItemOption func(cfg *ItemConfig)
 
@@ -124,6 +485,21 @@ func ExpireAt(t time.Time) ItemOption {
 	}
 }
 
+// Sliding makes the item expire after it has not been accessed for d, every successful
+// read (Get, GetWithExpiration, Has...) pushes its expiration forward by d
+func Sliding(d time.Duration) ItemOption {
+	return func(cfg *ItemConfig) {
+		cfg = cfg.Sliding(d)
+	}
+}
+
+// WithCost sets the cost of an item, overriding the Weigher of the cache
+func WithCost(cost int64) ItemOption {
+	return func(cfg *ItemConfig) {
+		cfg = cfg.Cost(cost)
+	}
+}
+
 // New creates a cache with K as string
 func New[V any](defaultExpiration time.Duration, opts ...Option) *Cache[string, V] {
 	return newCache[string, V](defaultExpiration, opts...)
@@ -144,9 +520,25 @@ func (c *Cache[K, V]) Has(k K) (found bool) {
 	return c.has(k)
 }
 
-// Get a value associated to the given key
+// Get a value associated to the given key.
+// If the cache has a Loader, a missing key is loaded and stored in the cache.
 func (c *Cache[K, V]) Get(k K) (value V, found bool) {
-	return c.get(k)
+	value, _, found = c.getWithExpirationOrLoad(k)
+	return
+}
+
+// GetWithVersion gets a value and its version from the cache.
+// The version changes every time the item is written, see SetIfVersion.
+func (c *Cache[K, V]) GetWithVersion(k K) (value V, version uint64, found bool) {
+	return c.getWithVersion(k)
+}
+
+// GetOrLoad gets a value associated to the given key, or calls the loader on a miss and stores the
+// loaded value in the cache with the given options. Concurrent misses for the same key are collapsed
+// into a single loader call, which receives the context of the caller that triggered it.
+// Nothing is stored if the loader returns an error.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, k K, loader func(ctx context.Context) (V, error), opts ...ItemOption) (V, error) {
+	return c.getOrLoad(ctx, k, loader, opts...)
 }
 
 // Take retrieve a value associated to the given key and delete the key from the cache
@@ -156,8 +548,9 @@ func (c *Cache[K, V]) Take(k K) (value V, found bool) {
 
 // GetWithExpiration gets a value and its expiration time from the cache.
 // If the item never expires a zero value for time.Time is returned.
+// If the cache has a Loader, a missing key is loaded and stored in the cache.
 func (c *Cache[K, V]) GetWithExpiration(k K) (value V, expiration time.Time, found bool) {
-	return c.getWithExpiration(k, false)
+	return c.getWithExpirationOrLoad(k)
 }
 
 // Set a key/value pair in the cache
@@ -165,6 +558,13 @@ func (c *Cache[K, V]) Set(k K, v V, opts ...ItemOption) {
 	c.set(k, v, opts...)
 }
 
+// SetIfVersion sets a new value for the cache key only if the item still has the given version
+// (obtained from GetWithVersion). Returns ErrVersionMismatch if the item has been written in the meantime,
+// or ErrItemNotFound if it does not exist anymore.
+func (c *Cache[K, V]) SetIfVersion(k K, v V, version uint64, opts ...ItemOption) error {
+	return c.setIfVersion(k, v, version, opts...)
+}
+
 // Add an item to the cache only if an item doesn't already exist for the given
 // key, or if the existing item has expired. Returns an error otherwise.
 func (c *Cache[K, V]) Add(k K, v V, opts ...ItemOption) error {
@@ -177,14 +577,22 @@ func (c *Cache[K, V]) Replace(k K, v V, opts ...ItemOption) error {
 	return c.replace(k, v, opts...)
 }
 
+// Touch resets the expiration of an item without reading it. Without options the item expires after
+// the same duration it was stored with, otherwise the options replace its expiration.
+// Returns ErrItemNotFound if the key does not exist or has expired.
+func (c *Cache[K, V]) Touch(k K, opts ...ItemOption) error {
+	return c.touch(k, opts...)
+}
+
 // Delete an item from the cache
 func (c *Cache[K, V]) Delete(k K) {
 	c.delete(k)
 }
 
-// DeleteExpired deletes all expired items from the cache
+// DeleteExpired deletes all expired items from the cache, and from its overflow tier
 func (c *Cache[K, V]) DeleteExpired() {
 	c.deleteExpired()
+	c.deleteExpiredSpilled()
 }
 
 // DeleteAll deletes all items from the cache
@@ -198,6 +606,17 @@ func (c *Cache[K, V]) Len() int {
 	return c.len()
 }
 
+// Cost returns the total cost of the items in the cache. This may include items that have
+// expired, but have not yet been cleaned up.
+func (c *Cache[K, V]) Cost() int64 {
+	return c.getCost()
+}
+
+// Stats returns a snapshot of the statistics of the cache, it is empty unless RecordStats is used
+func (c *Cache[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
 // Items copies all unexpired items in the cache into a new map and returns it.
 func (c *Cache[K, V]) Items() map[K]Item[V] {
 	return c.getItems()
@@ -212,14 +631,61 @@ func newCache[K comparable, V any](defaultExpiration time.Duration, opts ...Opti
 	c.ctx, c.cancel = context.WithCancel(cfg.ctx)
 	c.clock = cfg.clock
 	c.defaultExpiration = defaultExpiration
-	c.items = mtx.NewRWMtxMap[K, Item[V]]()
+	c.weigher = typedOption[func(K, V) int64]("Weigher", cfg.weigher)
+	c.onEvicted = typedOption[func(K, V, EvictionReason)]("OnEvicted", cfg.onEvicted)
+	c.loader = typedOption[Loader[K, V]]("WithLoader", cfg.loader)
+	c.refreshAfter = cfg.refreshAfter
+	c.defaultSliding = cfg.defaultSliding
+	c.overflow = typedOption[*DiskTier[K, V]]("Overflow", cfg.overflow)
+	if cfg.recordStats {
+		c.stats = new(statsRecorder)
+	}
+	c.keyCodec = codecOr[K]("KeyCodec", cfg.keyCodec)
+	c.valueCodec = codecOr[V]("ValueCodec", cfg.valueCodec)
+	c.expiryThreshold = DefaultExpirationIndexThreshold
+	if cfg.expirationIndex != nil {
+		c.expiryThreshold = utils.Ternary(*cfg.expirationIndex, 0, -1)
+	}
+	newStore := typedOption[func() Store[K, V]]("WithStore", cfg.store)
+	if newStore == nil {
+		newStore = newMapStore[K, V]
+	}
+	n := shardCount(cfg.shards)
+	c.seed = maphash.MakeSeed()
+	c.shards = make([]*shard[K, V], n)
+	for i := range c.shards {
+		c.shards[i] = newShard(newStore(), splitCapacity(cfg.maxItems, n), splitCapacity(cfg.maxCost, n), cfg.policy, c.expiryThreshold == 0)
+	}
+	c.cleanupBatchSize = cfg.cleanupBatch
+	c.cleanupBatchTime = cfg.cleanupTime
+	c.adaptiveCleanup = cfg.adaptiveCleanup
 	c.cleanupEventsCh = make(chan struct{})
-	if cleanupInterval > 0 {
+	if cfg.janitor != nil {
+		c.janitor = cfg.janitor
+		c.janitorID = c.janitor.register(func() bool {
+			// Like the auto-cleanup goroutine, stop once the context of the cache is done
+			if c.ctx.Err() != nil {
+				return false
+			}
+			c.cleanupCycle()
+			return true
+		})
+	} else if cleanupInterval > 0 {
 		go c.autoCleanup(cleanupInterval)
 	}
 	return c
 }
 
+// typedOption returns the value of an option that depends on the types of the cache, the zero value if the option
+// is not set. It panics if the option was given for other types, rather than silently ignoring it.
+func typedOption[T any](name string, v any) T {
+	out, ok := v.(T)
+	if !ok && v != nil {
+		panic(fmt.Sprintf("cache: %s option of type %T, want %s", name, v, reflect.TypeFor[T]()))
+	}
+	return out
+}
+
 func newSet[K comparable](defaultExpiration time.Duration, opts ...Option) *SetCache[K] {
 	return &SetCache[K]{c: newCache[K, struct{}](defaultExpiration, opts...)}
 }
@@ -231,7 +697,7 @@ func (c *Cache[K, V]) autoCleanup(cleanupInterval time.Duration) {
 		case <-c.ctx.Done():
 			return
 		}
-		c.deleteExpired()
+		c.cleanupCycle()
 		select {
 		case c.cleanupEventsCh <- struct{}{}:
 		default:
@@ -239,13 +705,43 @@ func (c *Cache[K, V]) autoCleanup(cleanupInterval time.Duration) {
 	}
 }
 
+// cleanupCycle runs and records one cycle of the auto-cleanup
+func (c *Cache[K, V]) cleanupCycle() {
+	start := c.now()
+	c.cleanup()
+	c.stats.recordCleanup(c.clock.Since(start))
+}
+
 func (c *Cache[K, V]) destroy() {
 	c.cancel()
+	if c.janitor != nil {
+		c.janitor.deregister(c.janitorID)
+	}
 	c.deleteAll()
 }
 
-func (c *Cache[K, V]) len() int {
-	return c.items.Len()
+func (c *Cache[K, V]) len() (out int) {
+	for _, s := range c.shards {
+		out += s.len()
+	}
+	return out
+}
+
+func (c *Cache[K, V]) getCost() (out int64) {
+	for _, s := range c.shards {
+		s.rWith(func(Store[K, V]) { out += s.cost })
+	}
+	return out
+}
+
+func (c *Cache[K, V]) costOf(k K, v V, cfg *ItemConfig) int64 {
+	if cfg.cost > 0 {
+		return cfg.cost
+	}
+	if c.weigher != nil {
+		return c.weigher(k, v)
+	}
+	return 1
 }
 
 func (c *Cache[K, V]) now() time.Time {
@@ -258,25 +754,46 @@ func (c *Cache[K, V]) nowNano() int64 {
 
 func (c *Cache[K, V]) getWithExpiration(k K, remove bool) (V, time.Time, bool) {
 	var zero V
+	item, found := c.getItem(k, remove)
+	if !found {
+		return zero, time.Time{}, false
+	}
+	return item.value, item.expirationTime(), true
+}
+
+// getItem returns the item associated to the given key if it is not expired
+func (c *Cache[K, V]) getItem(k K, remove bool) (item Item[V], found bool) {
 	now := c.nowNano()
-	var item Item[V]
-	var found bool
+	s := c.shard(k)
 	if remove {
-		item, found = c.items.LoadAndDelete(k)
+		var evicted []eviction[K, V]
+		s.with(func(st Store[K, V]) {
+			item, found = st.Load(k)
+			if !found && c.overflow != nil {
+				// remove deletes it from the overflow tier
+				item, found = c.overflow.getItem(k)
+			}
+			c.remove(s, st, k, now, Deleted, &evicted)
+		})
+		c.notifyEvicted(evicted)
 	} else {
-		item, found = c.items.Load(k)
+		item, found = s.load(k)
+		if (!found || item.isExpired(now)) && c.overflow != nil {
+			item, found = c.promote(s, k, now)
+		}
 	}
-	if !found {
-		return zero, time.Time{}, false
+	if !found || item.isExpired(now) {
+		return Item[V]{}, false
+	}
+	if !remove {
+		s.access(k)
 	}
-	e := time.Time{}
-	if item.expiration > 0 {
-		if item.expiration < now {
-			return zero, time.Time{}, false
+	if !remove && item.sliding {
+		if slid, err := c.updateItem(k, func(item *Item[V]) { item.expiration = now + item.ttl }); err == nil {
+			item = slid
 		}
-		e = item.Expiration()
 	}
-	return item.value, e, found
+	return item, true
 }
 
 func (c *Cache[K, V]) get(k K) (V, bool) {
@@ -286,69 +803,408 @@ func (c *Cache[K, V]) get(k K) (V, bool) {
 
 func (c *Cache[K, V]) take(k K) (V, bool) {
 	value, _, found := c.getWithExpiration(k, true)
+	c.stats.recordLookup(found)
 	return value, found
 }
 
+func (c *Cache[K, V]) getOrLoad(ctx context.Context, k K, loader func(ctx context.Context) (V, error), opts ...ItemOption) (V, error) {
+	value, found := c.get(k)
+	c.stats.recordLookup(found)
+	if found {
+		return value, nil
+	}
+	item, err := c.loads.Do(k, func() (Item[V], error) {
+		value, err := c.timeLoad(func() (V, error) { return loader(ctx) })
+		if err != nil {
+			return Item[V]{}, err
+		}
+		return c.set(k, value, opts...), nil
+	})
+	return item.value, err
+}
+
 func (c *Cache[K, V]) has(k K) bool {
 	return utils.Second(c.get(k))
 }
 
-func (c *Cache[K, V]) set(k K, v V, opts ...ItemOption) {
+func (c *Cache[K, V]) set(k K, v V, opts ...ItemOption) Item[V] {
+	item := c.newItem(k, v, opts...)
+	c.setItemIf(k, item, nil)
+	return item
+}
+
+func (c *Cache[K, V]) newItem(k K, v V, opts ...ItemOption) Item[V] {
 	cfg := &ItemConfig{clock: c.clock}
 	utils.ApplyOptions(cfg, opts)
-	d := utils.Or(cfg.d, c.defaultExpiration)
-	e := int64(NoExpiration)
-	if d != time.Duration(e) {
-		e = c.now().Add(d).UnixNano()
+	now := c.nowNano()
+	item := Item[V]{value: v, cost: c.costOf(k, v, cfg), created: now}
+	d, sliding := c.ttl(cfg)
+	item.setTTL(now, d, sliding)
+	return item
+}
+
+// ttl returns the expiration duration of an item stored with the given options, and either or not it is sliding
+func (c *Cache[K, V]) ttl(cfg *ItemConfig) (time.Duration, bool) {
+	if cfg.sliding > 0 {
+		return cfg.sliding, true
+	}
+	if cfg.d == 0 && c.defaultSliding > 0 {
+		return c.defaultSliding, true
 	}
-	c.items.Store(k, Item[V]{value: v, expiration: e})
+	return utils.Or(cfg.d, c.defaultExpiration), false
 }
 
-func (c *Cache[K, V]) add(k K, v V, opts ...ItemOption) error {
-	if c.has(k) {
-		return ErrItemAlreadyExists
+func (c *Cache[K, V]) touch(k K, opts ...ItemOption) error {
+	now := c.nowNano()
+	var d time.Duration
+	var sliding bool
+	if len(opts) > 0 {
+		cfg := &ItemConfig{clock: c.clock}
+		utils.ApplyOptions(cfg, opts)
+		d, sliding = c.ttl(cfg)
 	}
-	c.set(k, v, opts...)
-	return nil
+	_, err := c.updateItem(k, func(item *Item[V]) {
+		if len(opts) > 0 {
+			item.setTTL(now, d, sliding)
+		} else if item.ttl > 0 {
+			item.expiration = now + item.ttl
+		}
+	})
+	return err
+}
+
+// updateItem modifies an unexpired item in place under the items lock, without notifying the eviction policy
+func (c *Cache[K, V]) updateItem(k K, fn func(item *Item[V])) (out Item[V], err error) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	s := c.shard(k)
+	s.with(func(st Store[K, V]) {
+		if _, found := c.lookup(s, st, k, now, &evicted); !found {
+			err = ErrItemNotFound
+			return
+		}
+		st.Compute(k, func(item Item[V], found bool) (Item[V], Action) {
+			// The promoted item may have been evicted right away
+			if !found {
+				err = ErrItemNotFound
+				return item, ComputeKeep
+			}
+			fn(&item)
+			out = item
+			return item, ComputeSet
+		})
+		if err == nil {
+			s.indexExpiration(k, out)
+		}
+	})
+	c.notifyEvicted(evicted)
+	return out, err
 }
 
-func (c *Cache[K, V]) replace(k K, v V, opts ...ItemOption) error {
-	if !c.has(k) {
-		return ErrItemNotFound
+// setItemIf stores the item, if a predicate is given the item is only stored if the predicate
+// accepts the current item associated to the key
+func (c *Cache[K, V]) setItemIf(k K, item Item[V], pred func(current Item[V], found bool) bool) (stored bool) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	s := c.shard(k)
+	s.with(func(st Store[K, V]) {
+		if pred != nil {
+			if current, found := st.Load(k); !pred(current, found) {
+				return
+			}
+		}
+		c.store(s, st, k, item, now, &evicted)
+		stored = true
+	})
+	c.notifyEvicted(evicted)
+	return stored
+}
+
+// store must be called with the items lock of the shard held, it inserts the item with a new version
+// and evicts the victims chosen by the policy until the shard fits its capacity
+func (c *Cache[K, V]) store(s *shard[K, V], st Store[K, V], k K, item Item[V], now int64, evicted *[]eviction[K, V]) Item[V] {
+	item.version = c.versions.Add(1)
+	return c.put(s, st, k, item, now, evicted)
+}
+
+// put is like store, but keeps the version of the item
+func (c *Cache[K, V]) put(s *shard[K, V], st Store[K, V], k K, item Item[V], now int64, evicted *[]eviction[K, V]) Item[V] {
+	_, replaced := st.Load(k)
+	c.drop(s, st, k, now, Replaced, evicted)
+	if c.overflow != nil {
+		c.dropSpilled(k, now, Replaced, evicted)
 	}
-	c.set(k, v, opts...)
-	return nil
+	// Make room before a new key is added, otherwise the policy could choose it as the victim
+	if s.policy != nil && !replaced {
+		c.evict(s, st, k, now, evicted, func() bool { return s.overCapacityWith(st, item.cost) })
+	}
+	st.Store(k, item)
+	s.cost += item.cost
+	s.indexExpiration(k, item)
+	if s.policy == nil {
+		return item
+	}
+	s.policy.Add(k)
+	// A replaced item may be heavier than the old one, and an item may be heavier than the whole shard
+	c.evict(s, st, k, now, evicted, func() bool { return s.overCapacity(st) })
+	return item
+}
+
+// evict drops the victims chosen by the policy of the shard to make room for k, for as long as full returns true
+func (c *Cache[K, V]) evict(s *shard[K, V], st Store[K, V], k K, now int64, evicted *[]eviction[K, V], full func() bool) {
+	for full() {
+		victim, ok := s.policy.Evict(k)
+		if !ok {
+			break
+		}
+		c.drop(s, st, victim, now, Capacity, evicted)
+	}
+}
+
+// remove must be called with the items lock of the shard held
+func (c *Cache[K, V]) remove(s *shard[K, V], st Store[K, V], k K, now int64, reason EvictionReason, evicted *[]eviction[K, V]) {
+	c.drop(s, st, k, now, reason, evicted)
+	if s.policy != nil {
+		s.policy.Remove(k)
+	}
+	if c.overflow != nil {
+		c.dropSpilled(k, now, reason, evicted)
+	}
+}
+
+// promote moves the item associated to the key from the overflow tier to memory
+func (c *Cache[K, V]) promote(s *shard[K, V], k K, now int64) (item Item[V], found bool) {
+	var evicted []eviction[K, V]
+	s.with(func(st Store[K, V]) {
+		// The item may have been stored since it was looked up
+		item, found = c.lookup(s, st, k, now, &evicted)
+	})
+	c.notifyEvicted(evicted)
+	return item, found
+}
+
+// lookup returns the unexpired item associated to the key, moving it from the overflow tier to memory if it was spilled.
+// Must be called while holding the shard lock.
+func (c *Cache[K, V]) lookup(s *shard[K, V], st Store[K, V], k K, now int64, evicted *[]eviction[K, V]) (item Item[V], found bool) {
+	if item, found = st.Load(k); found && !item.isExpired(now) {
+		return item, true
+	}
+	if c.overflow != nil {
+		// The item keeps its version and creation time, it was only moved
+		if item, found = c.overflow.takeItem(k); found && !item.isExpired(now) {
+			if item.version == 0 {
+				// Written directly to the tier
+				item.version = c.versions.Add(1)
+			}
+			return c.put(s, st, k, item, now, evicted), true
+		} else if found {
+			c.report(k, item, now, Expired, evicted)
+		}
+	}
+	return Item[V]{}, false
+}
+
+// drop deletes the item from the store without notifying the policy, it must be called with the items lock of the shard held.
+// An item that already expired is always reported as such.
+func (c *Cache[K, V]) drop(s *shard[K, V], st Store[K, V], k K, now int64, reason EvictionReason, evicted *[]eviction[K, V]) {
+	if item, ok := st.Load(k); ok {
+		s.cost -= item.cost
+		st.Delete(k)
+		if s.expiry != nil {
+			s.expiry.Remove(k)
+		}
+		if reason == Capacity && c.overflow != nil && !item.isExpired(now) && c.spill(k, item) {
+			return
+		}
+		c.report(k, item, now, reason, evicted)
+	}
+}
+
+// dropSpilled deletes the item from the overflow tier, and reports it like drop does for the items in memory
+func (c *Cache[K, V]) dropSpilled(k K, now int64, reason EvictionReason, evicted *[]eviction[K, V]) {
+	if !c.reportsEvictions() {
+		c.overflow.handle(c.overflow.delete(k))
+	} else if item, found := c.overflow.takeItem(k); found {
+		c.report(k, item, now, reason, evicted)
+	}
+}
+
+// report records the eviction of an item in the stats, and adds it to the evictions to notify.
+// An item that already expired is always reported as such.
+func (c *Cache[K, V]) report(k K, item Item[V], now int64, reason EvictionReason, evicted *[]eviction[K, V]) {
+	reason = utils.Ternary(item.isExpired(now), Expired, reason)
+	c.stats.recordEviction(reason)
+	if c.onEvicted != nil {
+		*evicted = append(*evicted, eviction[K, V]{k: k, v: item.value, reason: reason})
+	}
+}
+
+// reportsEvictions returns either or not the evicted items have to be reported, to the callback or the stats
+func (c *Cache[K, V]) reportsEvictions() bool {
+	return c.onEvicted != nil || c.stats != nil
+}
+
+func (c *Cache[K, V]) add(k K, v V, opts ...ItemOption) (err error) {
+	item := c.newItem(k, v, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if found {
+			err = ErrItemAlreadyExists
+			return current, ComputeKeep
+		}
+		return item, ComputeSet
+	})
+	return err
+}
+
+func (c *Cache[K, V]) getWithVersion(k K) (V, uint64, bool) {
+	item, found := c.getItem(k, false)
+	return item.value, item.version, found
+}
+
+func (c *Cache[K, V]) setIfVersion(k K, v V, version uint64, opts ...ItemOption) (err error) {
+	item := c.newItem(k, v, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if !found {
+			err = ErrItemNotFound
+			return current, ComputeKeep
+		} else if current.version != version {
+			err = ErrVersionMismatch
+			return current, ComputeKeep
+		}
+		return item, ComputeSet
+	})
+	return err
+}
+
+func (c *Cache[K, V]) replace(k K, v V, opts ...ItemOption) (err error) {
+	item := c.newItem(k, v, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if !found {
+			err = ErrItemNotFound
+			return current, ComputeKeep
+		}
+		return item, ComputeSet
+	})
+	return err
 }
 
 func (c *Cache[K, V]) deleteAll() {
-	c.items.Clear()
+	for _, s := range c.shards {
+		c.clearShard(s)
+	}
+	if c.overflow != nil {
+		var evicted []eviction[K, V]
+		if c.reportsEvictions() {
+			now := c.nowNano()
+			c.overflow.rangeItems(func(k K, item Item[V]) { c.report(k, item, now, Cleared, &evicted) })
+		}
+		c.overflow.DeleteAll()
+		c.notifyEvicted(evicted)
+	}
+}
+
+// spill writes an item evicted for capacity reasons to the overflow tier, returns either or not it was written
+func (c *Cache[K, V]) spill(k K, item Item[V]) bool {
+	err := c.overflow.setItem(k, item)
+	c.overflow.handle(err)
+	return err == nil
+}
+
+func (c *Cache[K, V]) clearShard(s *shard[K, V]) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	s.with(func(st Store[K, V]) {
+		// Without callback nor stats, nothing needs to know about the dropped items
+		if c.reportsEvictions() {
+			st.Range(func(k K, _ Item[V]) bool {
+				c.drop(s, st, k, now, Cleared, &evicted)
+				return true
+			})
+		}
+		st.Clear()
+		s.cost = 0
+		if s.expiry != nil {
+			s.expiry.Clear()
+		}
+		if s.policy != nil {
+			s.policy.Clear()
+		}
+	})
+	c.notifyEvicted(evicted)
 }
 
 func (c *Cache[K, V]) delete(k K) {
-	c.items.Delete(k)
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	s := c.shard(k)
+	s.with(func(st Store[K, V]) {
+		c.remove(s, st, k, now, Deleted, &evicted)
+	})
+	c.notifyEvicted(evicted)
 }
 
 func (c *Cache[K, V]) deleteExpired() {
+	for _, s := range c.shards {
+		c.deleteExpiredShard(s)
+	}
+}
+
+// deleteExpiredSpilled deletes the expired items of the overflow tier
+func (c *Cache[K, V]) deleteExpiredSpilled() {
+	if c.overflow == nil {
+		return
+	}
 	now := c.nowNano()
-	c.items.With(func(m *map[K]Item[V]) {
-		for k, item := range *m {
-			if item.isExpired(now) {
-				delete(*m, k)
+	var evicted []eviction[K, V]
+	var onExpired func(k K, item Item[V])
+	if c.reportsEvictions() {
+		onExpired = func(k K, item Item[V]) { c.report(k, item, now, Expired, &evicted) }
+	}
+	c.stats.recordExpirations(c.overflow.expire(now, onExpired))
+	c.notifyEvicted(evicted)
+}
+
+func (c *Cache[K, V]) deleteExpiredShard(s *shard[K, V]) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	expired := 0
+	s.with(func(st Store[K, V]) {
+		// The threshold is for the whole cache, the shards are assumed to be balanced
+		if s.expiry == nil && c.expiryThreshold >= 0 && st.Len()*len(c.shards) > c.expiryThreshold {
+			s.buildExpirationIndex(st)
+		}
+		if s.expiry != nil {
+			for _, k := range s.expiry.PopExpired(now, 0) {
+				c.remove(s, st, k, now, Expired, &evicted)
+				expired++
 			}
+			return
 		}
+		st.Range(func(k K, item Item[V]) bool {
+			if item.isExpired(now) {
+				c.remove(s, st, k, now, Expired, &evicted)
+				expired++
+			}
+			return true
+		})
 	})
+	c.stats.recordExpirations(expired)
+	c.notifyEvicted(evicted)
 }
 
 func (c *Cache[K, V]) getItems() (out map[K]Item[V]) {
 	now := c.nowNano()
-	c.items.RWith(func(m map[K]Item[V]) {
-		out = make(map[K]Item[V], len(m))
-		for k, v := range m {
-			if !v.isExpired(now) {
-				out[k] = v
-			}
-		}
-	})
+	out = make(map[K]Item[V], c.len())
+	for _, s := range c.shards {
+		s.rWith(func(st Store[K, V]) {
+			st.Range(func(k K, v Item[V]) bool {
+				if !v.isExpired(now) {
+					out[k] = v
+				}
+				return true
+			})
+		})
+	}
 	return out
 }
 
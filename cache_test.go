@@ -2,10 +2,15 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/alaingilbert/cache/internal/policy"
 	"github.com/alaingilbert/cache/internal/utils"
 	"github.com/alaingilbert/clockwork"
 	"github.com/stretchr/testify/assert"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -187,6 +192,52 @@ func TestDeleteExpired(t *testing.T) {
 	assert.Equal(t, 1, c.Len())
 }
 
+func TestExpirationIndex(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock), ExpirationIndex(true))
+	c.Set("key1", "val1")
+	c.Set("key2", "val2", NoExpire)
+	c.Set("key3", "val3", ExpireIn(6*time.Minute))
+	c.Set("key4", "val4", Sliding(2*time.Minute))
+	c.Set("key5", "val5")
+	c.Delete("key5")
+	assert.Equal(t, 3, c.shards[0].expiry.Len())
+	clock.Advance(30 * time.Second)
+	assert.NoError(t, c.Touch("key1"))
+	c.Get("key4")
+	clock.Advance(40 * time.Second)
+	c.DeleteExpired()
+	assert.Equal(t, 4, c.Len())
+	clock.Advance(2 * time.Minute)
+	c.DeleteExpired()
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, 1, c.shards[0].expiry.Len())
+	c.DeleteAll()
+	assert.Equal(t, 0, c.shards[0].expiry.Len())
+}
+
+func TestExpirationIndexThreshold(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock))
+	assert.Nil(t, c.shards[0].expiry)
+	c.expiryThreshold = 2
+	c.Set("key1", "val1")
+	c.Set("key2", "val2")
+	c.DeleteExpired()
+	assert.Nil(t, c.shards[0].expiry)
+	c.Set("key3", "val3", ExpireIn(2*time.Minute))
+	c.DeleteExpired()
+	assert.Equal(t, 3, c.shards[0].expiry.Len())
+	clock.Advance(61 * time.Second)
+	c.DeleteExpired()
+	assert.Equal(t, 1, c.Len())
+
+	c2 := New[string](time.Minute, WithClock(clock), ExpirationIndex(false))
+	c2.Set("key1", "val1")
+	c2.DeleteExpired()
+	assert.Nil(t, c2.shards[0].expiry)
+}
+
 func TestAutoClean(t *testing.T) {
 	clock := clockwork.NewFakeClock()
 	c := New[string](time.Minute, WithClock(clock))
@@ -342,3 +393,393 @@ func TestGetCastInto(t *testing.T) {
 	assert.False(t, GetCastInto[int64](c1, "not-exist", &v4))
 	assert.Equal(t, int64(0), v4)
 }
+
+func TestMaxItems(t *testing.T) {
+	c := New[int](time.Minute, MaxItems(3))
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	c.Set("key3", 3)
+	_, _ = c.Get("key1")
+	c.Set("key4", 4)
+	assert.Equal(t, 3, c.Len())
+	assert.False(t, c.Has("key2"))
+	assert.True(t, c.Has("key1"))
+	assert.NoError(t, c.Add("key5", 5))
+	assert.False(t, c.Has("key3"))
+	assert.NoError(t, c.Replace("key4", 44))
+	c.Set("key6", 6)
+	assert.False(t, c.Has("key1"))
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestMaxItemsDelete(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), MaxItems(2))
+	c.Set("key1", 1)
+	c.Set("key2", 2, NoExpire)
+	c.Delete("key1")
+	c.Set("key3", 3)
+	assert.True(t, c.Has("key2"))
+	assert.True(t, c.Has("key3"))
+	_, _ = c.Take("key3")
+	clock.Advance(2 * time.Minute)
+	c.Set("key4", 4)
+	c.Set("key5", 5)
+	c.DeleteExpired()
+	assert.Equal(t, 2, c.Len())
+	c.DeleteAll()
+	assert.Equal(t, 0, c.Len())
+	c.Set("key6", 6)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestEvictionPolicyLFU(t *testing.T) {
+	c := New[int](time.Minute, MaxItems(3), EvictionPolicy(LFU))
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	c.Set("key3", 3)
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key3")
+	c.Set("key4", 4)
+	assert.False(t, c.Has("key2"))
+	c.Set("key5", 5)
+	assert.False(t, c.Has("key4"))
+	assert.True(t, c.Has("key1"))
+	assert.True(t, c.Has("key3"))
+	assert.Equal(t, 3, c.Len())
+}
+
+// A new key must be kept when all the keys of a full cache have been read
+func TestEvictionPolicyFullyRead(t *testing.T) {
+	for _, p := range []Policy{LRU, LFU, ARC, SIEVE, S3FIFO, TinyLFU} {
+		c := New[int](time.Minute, MaxItems(3), EvictionPolicy(p))
+		c.Set("key1", 1)
+		c.Set("key2", 2)
+		c.Set("key3", 3)
+		_, _ = c.Get("key1")
+		_, _ = c.Get("key2")
+		_, _ = c.Get("key3")
+		c.Set("key4", 4)
+		value, found := c.Get("key4")
+		assert.True(t, found, p)
+		assert.Equal(t, 4, value, p)
+		assert.Equal(t, 3, c.Len(), p)
+	}
+}
+
+func TestEvictionPolicyTinyLFU(t *testing.T) {
+	c := NewWithKey[int, int](time.Minute, MaxItems(100), EvictionPolicy(TinyLFU))
+	// The sketch is randomly seeded, a fixed hash makes the admission decisions reproducible
+	c.shards[0].policy.(*policy.TinyLFU[int]).SetHash(fixedHash)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+		for j := 0; j < 5; j++ {
+			_, _ = c.Get(i)
+		}
+	}
+	for i := 1000; i < 2000; i++ {
+		c.Set(i, i)
+	}
+	assert.Equal(t, 100, c.Len())
+	hot := 0
+	for i := 0; i < 100; i++ {
+		if c.Has(i) {
+			hot++
+		}
+	}
+	assert.GreaterOrEqual(t, hot, 90)
+}
+
+// fixedHash is the finalizer of splitmix64
+func fixedHash(k int) uint64 {
+	x := uint64(k)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func TestEvictionPolicyARC(t *testing.T) {
+	c := New[int](time.Minute, MaxItems(2), EvictionPolicy(ARC))
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	_, _ = c.Get("key1")
+	c.Set("key3", 3)
+	assert.False(t, c.Has("key2"))
+	assert.True(t, c.Has("key1"))
+	assert.True(t, c.Has("key3"))
+	// "key2" is remembered by a ghost list and comes back as a frequent item
+	c.Set("key2", 2)
+	assert.Equal(t, 2, c.Len())
+	assert.True(t, c.Has("key2"))
+}
+
+func TestEvictionPolicySIEVE(t *testing.T) {
+	c := New[int](time.Minute, MaxItems(3), EvictionPolicy(SIEVE))
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	c.Set("key3", 3)
+	_, _ = c.Get("key1")
+	c.Set("key4", 4)
+	assert.Equal(t, 3, c.Len())
+	assert.False(t, utils.Second(c.shards[0].load("key2")))
+	assert.True(t, utils.Second(c.shards[0].load("key1")))
+}
+
+func TestEvictionPolicyS3FIFO(t *testing.T) {
+	c := New[int](time.Minute, MaxItems(10), EvictionPolicy(S3FIFO))
+	c.Set("key1", 1)
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key1")
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprintf("scan%d", i), i)
+	}
+	assert.Equal(t, 10, c.Len())
+	assert.True(t, c.Has("key1"))
+}
+
+// With a small queue of a single key, a new key must survive until it is read
+func TestEvictionPolicyS3FIFOSmallQueue(t *testing.T) {
+	for _, opts := range [][]Option{{MaxItems(5)}, {MaxItems(100), Shards(16)}} {
+		c := NewWithKey[int, int](time.Minute, append(opts, EvictionPolicy(S3FIFO))...)
+		for i := 0; i < 200; i++ {
+			c.Set(i, i)
+			value, found := c.Get(i)
+			assert.True(t, found)
+			assert.Equal(t, i, value)
+		}
+	}
+}
+
+func TestMaxCost(t *testing.T) {
+	c := New[string](time.Minute, MaxCost(10), Weigher(func(k, v string) int64 { return int64(len(v)) }))
+	c.Set("key1", "aaaa")
+	c.Set("key2", "bbbb")
+	assert.Equal(t, int64(8), c.Cost())
+	c.Set("key3", "cccc")
+	assert.Equal(t, int64(8), c.Cost())
+	assert.Equal(t, 2, c.Len())
+	assert.False(t, c.Has("key1"))
+	c.Set("key2", "b")
+	assert.Equal(t, int64(5), c.Cost())
+	c.Set("key4", "d", WithCost(6))
+	assert.Equal(t, int64(7), c.Cost())
+	assert.Equal(t, 2, c.Len())
+	assert.False(t, c.Has("key3"))
+	c.Set("key5", "eeeeeeeeeeee")
+	assert.Equal(t, int64(0), c.Cost())
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCost(t *testing.T) {
+	c := New[string](time.Minute)
+	c.Set("key1", "val1")
+	c.Set("key2", "val2", WithCost(5))
+	assert.Equal(t, int64(6), c.Cost())
+	assert.Equal(t, int64(5), c.Items()["key2"].Cost())
+	c.Delete("key2")
+	assert.Equal(t, int64(1), c.Cost())
+	_, _ = c.Take("key1")
+	assert.Equal(t, int64(0), c.Cost())
+	c.Set("key1", "val1", WithCost(3))
+	c.DeleteAll()
+	assert.Equal(t, int64(0), c.Cost())
+}
+
+func TestOptionTypeMismatch(t *testing.T) {
+	assert.PanicsWithValue(t, "cache: Weigher option of type func(int, string) int64, want func(string, string) int64", func() {
+		New[string](time.Minute, Weigher(func(k int, v string) int64 { return 10 }))
+	})
+	assert.Panics(t, func() { New[string](time.Minute, OnEvicted(func(string, int, EvictionReason) {})) })
+	assert.Panics(t, func() {
+		New[string](time.Minute, WithLoader[string, int](LoaderFunc[string, int](func(context.Context, string) (int, error) { return 0, nil })))
+	})
+	assert.Panics(t, func() { New[string](time.Minute, KeyCodec[int](JSONCodec[int]{})) })
+	assert.Panics(t, func() { New[string](time.Minute, ValueCodec[int](JSONCodec[int]{})) })
+	// The options matching the types of the cache are used
+	assert.NotPanics(t, func() {
+		New[string](time.Minute, Weigher(func(k string, v string) int64 { return 10 }), KeyCodec[string](JSONCodec[string]{}))
+	})
+}
+
+func TestOnEvicted(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	evicted := map[string]EvictionReason{}
+	var c *Cache[string, string]
+	c = New[string](time.Minute, WithClock(clock), MaxItems(3), OnEvicted(func(k, v string, reason EvictionReason) {
+		evicted[k+":"+v] = reason
+		// Calling back into the cache must not deadlock
+		_ = c.Len()
+	}))
+	c.Set("key1", "val1")
+	c.Set("key1", "val2")
+	assert.Equal(t, Replaced, evicted["key1:val1"])
+	c.Set("key2", "val2")
+	c.Set("key3", "val3")
+	c.Set("key4", "val4")
+	assert.Equal(t, Capacity, evicted["key1:val2"])
+	c.Delete("key2")
+	assert.Equal(t, Deleted, evicted["key2:val2"])
+	_, _ = c.Take("key3")
+	assert.Equal(t, Deleted, evicted["key3:val3"])
+	c.Set("key5", "val5", NoExpire)
+	clock.Advance(2 * time.Minute)
+	c.DeleteExpired()
+	assert.Equal(t, Expired, evicted["key4:val4"])
+	c.Destroy()
+	assert.Equal(t, Cleared, evicted["key5:val5"])
+	assert.Equal(t, 6, len(evicted))
+}
+
+func TestOnEvictedExpiredOverwrite(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var reasons []EvictionReason
+	c := New[int](time.Minute, WithClock(clock), OnEvicted(func(_ string, _ int, reason EvictionReason) {
+		reasons = append(reasons, reason)
+	}))
+	c.Set("key1", 1)
+	clock.Advance(2 * time.Minute)
+	assert.NoError(t, c.Add("key1", 2))
+	assert.Equal(t, []EvictionReason{Expired}, reasons)
+	assert.Equal(t, "expired", reasons[0].String())
+}
+
+func TestGetOrLoad(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock))
+	loader := func(v int, err error) func(context.Context) (int, error) {
+		return func(context.Context) (int, error) { return v, err }
+	}
+	v, err := c.GetOrLoad(context.Background(), "key1", loader(1, nil), ExpireIn(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v, err = c.GetOrLoad(context.Background(), "key1", loader(2, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	clock.Advance(2 * time.Second)
+	v, err = c.GetOrLoad(context.Background(), "key1", loader(3, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v)
+	someErr := errors.New("some error")
+	_, err = c.GetOrLoad(context.Background(), "key2", loader(4, someErr))
+	assert.ErrorIs(t, err, someErr)
+	assert.False(t, c.Has("key2"))
+}
+
+func TestGetOrLoadDeduplicates(t *testing.T) {
+	c := New[int](time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), "key1", loader)
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestSetIfVersion(t *testing.T) {
+	c := New[int](time.Minute)
+	_, _, found := c.GetWithVersion("key1")
+	assert.False(t, found)
+	assert.ErrorIs(t, c.SetIfVersion("key1", 1, 0), ErrItemNotFound)
+
+	c.Set("key1", 1)
+	v, version, found := c.GetWithVersion("key1")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	assert.NoError(t, c.SetIfVersion("key1", 2, version))
+	assert.ErrorIs(t, c.SetIfVersion("key1", 3, version), ErrVersionMismatch)
+	assert.Equal(t, 2, utils.First(c.Get("key1")))
+
+	_, version, _ = c.GetWithVersion("key1")
+	_, _ = Increment(c, "key1", 1)
+	assert.ErrorIs(t, c.SetIfVersion("key1", 10, version), ErrVersionMismatch)
+	_, newVersion, _ := c.GetWithVersion("key1")
+	assert.Greater(t, newVersion, version)
+	assert.Equal(t, newVersion, c.Items()["key1"].Version())
+}
+
+func TestSetIfVersionConcurrent(t *testing.T) {
+	c := New[int](time.Minute)
+	c.Set("key1", 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, version, _ := c.GetWithVersion("key1")
+				if c.SetIfVersion("key1", v+1, version) == nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, utils.First(c.Get("key1")))
+}
+
+func TestSliding(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock))
+	c.Set("key1", "val1", Sliding(10*time.Second))
+	for i := 0; i < 5; i++ {
+		clock.Advance(8 * time.Second)
+		_, found := c.Get("key1")
+		assert.True(t, found)
+	}
+	_, expiration, found := c.GetWithExpiration("key1")
+	assert.True(t, found)
+	assert.True(t, clock.Now().Add(10*time.Second).Equal(expiration))
+	clock.Advance(11 * time.Second)
+	assert.False(t, c.Has("key1"))
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock), SlidingExpiration(10*time.Second))
+	c.Set("key1", "val1")
+	c.Set("key2", "val2", ExpireIn(15*time.Second))
+	clock.Advance(8 * time.Second)
+	assert.True(t, c.Has("key1"))
+	assert.True(t, c.Has("key2"))
+	clock.Advance(8 * time.Second)
+	assert.True(t, c.Has("key1"))
+	assert.False(t, c.Has("key2"))
+}
+
+func TestTouch(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock))
+	assert.ErrorIs(t, c.Touch("key1"), ErrItemNotFound)
+	c.Set("key1", "val1", ExpireIn(10*time.Second))
+	_, version, _ := c.GetWithVersion("key1")
+	clock.Advance(8 * time.Second)
+	assert.NoError(t, c.Touch("key1"))
+	clock.Advance(8 * time.Second)
+	assert.True(t, c.Has("key1"))
+	assert.NoError(t, c.Touch("key1", NoExpire))
+	clock.Advance(time.Hour)
+	_, expiration, found := c.GetWithExpiration("key1")
+	assert.True(t, found)
+	assert.True(t, expiration.IsZero())
+	assert.NoError(t, c.Touch("key1", ExpireIn(time.Second)))
+	_, newVersion, _ := c.GetWithVersion("key1")
+	assert.Equal(t, version, newVersion)
+	clock.Advance(2 * time.Second)
+	assert.ErrorIs(t, c.Touch("key1"), ErrItemNotFound)
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"github.com/alaingilbert/cache/internal/utils"
+	"iter"
+)
+
+// adaptiveSampleSize is the number of items checked by each round of the adaptive cleanup
+const adaptiveSampleSize = 20
+
+// adaptiveExpiredRatio is the ratio of expired items in a sample above which the adaptive cleanup keeps sampling
+const adaptiveExpiredRatio = 0.25
+
+// cleanup runs one cycle of the auto-cleanup
+func (c *Cache[K, V]) cleanup() {
+	switch {
+	case c.adaptiveCleanup:
+		c.cleanupAdaptive()
+	case c.cleanupBatchSize > 0 || c.cleanupBatchTime > 0:
+		c.cleanupIncremental()
+	default:
+		c.deleteExpired()
+	}
+	c.deleteExpiredSpilled()
+}
+
+// cleanupIncremental deletes the expired items in batches, the items lock is released between batches
+// so that the cache is never blocked for a whole cycle. Without an expiration index, the batches resume
+// the walk over the store where the previous batch left it (see Store.Range).
+func (c *Cache[K, V]) cleanupIncremental() {
+	for _, s := range c.shards {
+		c.cleanupIncrementalShard(s)
+	}
+}
+
+func (c *Cache[K, V]) cleanupIncrementalShard(s *shard[K, V]) {
+	var store Store[K, V]
+	// The walk starts with the first batch, and is paused between batches
+	walk, stop := iter.Pull2(func(yield func(K, Item[V]) bool) { store.Range(yield) })
+	defer s.with(func(Store[K, V]) { stop() })
+	for done := false; !done; {
+		done = c.expireBatch(s, func(st Store[K, V], now int64, next func() bool, expire func(k K)) bool {
+			store = st
+			for next() {
+				if s.expiry != nil {
+					k, expiration, ok := s.expiry.Peek()
+					if !ok || expiration >= now {
+						return true
+					}
+					s.expiry.Remove(k)
+					expire(k)
+					continue
+				}
+				k, item, ok := walk()
+				if !ok {
+					return true
+				}
+				if item.isExpired(now) {
+					expire(k)
+				}
+			}
+			return false
+		})
+	}
+}
+
+// cleanupAdaptive deletes the expired items of random samples, like Redis does. It keeps sampling while
+// the ratio of expired items in a sample is high, so a cycle stays short when few items have expired.
+func (c *Cache[K, V]) cleanupAdaptive() {
+	for _, s := range c.shards {
+		c.cleanupAdaptiveShard(s)
+	}
+}
+
+func (c *Cache[K, V]) cleanupAdaptiveShard(s *shard[K, V]) {
+	sampleSize := utils.Or(c.cleanupBatchSize, adaptiveSampleSize)
+	for done := false; !done; {
+		done = c.expireBatch(s, func(st Store[K, V], now int64, next func() bool, expire func(k K)) bool {
+			sampled, expired := 0, 0
+			// The iteration of the default store starts at a random position
+			st.Range(func(k K, item Item[V]) bool {
+				if sampled >= sampleSize || !next() {
+					return false
+				}
+				sampled++
+				if item.isExpired(now) {
+					expire(k)
+					expired++
+				}
+				return true
+			})
+			return float64(expired) <= adaptiveExpiredRatio*float64(sampled)
+		})
+	}
+}
+
+// expireBatch calls fn while holding the items lock of the shard. fn must stop as soon as next returns false, which happens
+// once the batch reached its size or duration, and calls expire for every expired key it finds.
+// It returns what fn returns.
+func (c *Cache[K, V]) expireBatch(s *shard[K, V], fn func(st Store[K, V], now int64, next func() bool, expire func(k K)) bool) (done bool) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	expired, n := 0, 0
+	start := c.now()
+	next := func() bool {
+		n++
+		return n == 1 || ((c.cleanupBatchSize <= 0 || n <= c.cleanupBatchSize) &&
+			(c.cleanupBatchTime <= 0 || c.clock.Since(start) < c.cleanupBatchTime))
+	}
+	s.with(func(st Store[K, V]) {
+		done = fn(st, now, next, func(k K) {
+			c.remove(s, st, k, now, Expired, &evicted)
+			expired++
+		})
+	})
+	c.stats.recordExpirations(expired)
+	c.notifyEvicted(evicted)
+	return done
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newCleanupCache creates a cache with 10 items that expire in a minute and 5 items that never expire,
+// the lengths of the cache seen by the eviction callback tell how many batches were run
+func newCleanupCache(clock clockwork.Clock, lengths *[]int, opts ...Option) *Cache[string, int] {
+	var c *Cache[string, int]
+	opts = append(opts, WithClock(clock), OnEvicted(func(_ string, _ int, _ EvictionReason) {
+		*lengths = append(*lengths, c.Len())
+	}))
+	c = New[int](time.Minute, opts...)
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("expired%d", i), i)
+	}
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i, NoExpire)
+	}
+	return c
+}
+
+func TestCleanupBatch(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var lengths []int
+	c := newCleanupCache(clock, &lengths, CleanupBatch(3, 0), ExpirationIndex(false), RecordStats)
+	clock.BlockUntil(1)
+	clock.Advance(DefaultCleanupInterval)
+	<-c.cleanupEventsCh
+	assert.Equal(t, 5, c.Len())
+	assert.Len(t, lengths, 10)
+	assert.Less(t, lengths[0], 15)
+	assert.Greater(t, lengths[0], 5)
+	assert.Equal(t, uint64(10), c.Stats().Expirations)
+}
+
+func TestCleanupBatchWalk(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	store := &countingStore[string, int]{mapStore: newMapStore[string, int]().(*mapStore[string, int])}
+	newStore := func() Store[string, int] { return store }
+	// The items visited when an expired item is reported tell how far the walk went
+	var visited []int
+	c := New[int](time.Minute, WithClock(clock), WithStore(newStore), CleanupBatch(3, 0), CleanupInterval(-1),
+		OnEvicted(func(string, int, EvictionReason) { visited = append(visited, store.visited) }))
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("expired%d", i), i)
+	}
+	for i := 0; i < 5; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i, NoExpire)
+	}
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, 5, c.Len())
+	assert.Len(t, visited, 10)
+	// The index is not built, and every batch resumes the walk: no item is visited twice,
+	// and no lock hold visits more than 3 items
+	assert.Nil(t, c.shards[0].expiry)
+	assert.Equal(t, 15, store.visited)
+	for _, n := range visited {
+		assert.Zero(t, n%3)
+	}
+	assert.Less(t, visited[0], 15)
+	assert.Equal(t, visited, slices.Sorted(slices.Values(visited)))
+}
+
+func TestCleanupBatchIndexed(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var lengths []int
+	store := &countingStore[string, int]{mapStore: newMapStore[string, int]().(*mapStore[string, int])}
+	newStore := func() Store[string, int] { return store }
+	c := newCleanupCache(clock, &lengths, CleanupBatch(3, 0), ExpirationIndex(true), WithStore(newStore), CleanupInterval(-1))
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, 5, c.Len())
+	assert.Equal(t, []int{12, 12, 12, 9, 9, 9, 6, 6, 6, 5}, lengths)
+	assert.Equal(t, 0, c.shards[0].expiry.Len())
+	// The batches only go through the index
+	assert.Equal(t, 0, store.visited)
+}
+
+func TestCleanupBatchTime(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var lengths []int
+	c := newCleanupCache(clock, &lengths, CleanupBatch(0, time.Millisecond), CleanupInterval(-1))
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	assert.Equal(t, 5, c.Len())
+	assert.Len(t, lengths, 10)
+}
+
+func TestAdaptiveCleanup(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var lengths []int
+	c := newCleanupCache(clock, &lengths, AdaptiveCleanup, CleanupBatch(8, 0), CleanupInterval(-1))
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	// Every sample of 8 items holds at least 3 expired items, until the whole cache fits in a sample
+	assert.Equal(t, 5, c.Len())
+	assert.Len(t, lengths, 10)
+}
+
+func TestAdaptiveCleanupStops(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), AdaptiveCleanup, CleanupInterval(-1))
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i, NoExpire)
+	}
+	c.Set("expired", 0)
+	clock.Advance(2 * time.Minute)
+	c.cleanup()
+	assert.GreaterOrEqual(t, c.Len(), 1000)
+	c.DeleteExpired()
+	assert.Equal(t, 1000, c.Len())
+}
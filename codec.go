@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInvalidEncoding is returned when the data given to a codec cannot be decoded
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+// Codec encodes and decodes values of type T, it is used to serialize the keys and values of a cache
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte, v *T) error
+}
+
+// GobCodec encodes values using encoding/gob.
+// Values of interface types must be registered with gob.Register.
+type GobCodec[T any] struct{}
+
+// Marshal ...
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal ...
+func (GobCodec[T]) Unmarshal(data []byte, v *T) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// JSONCodec encodes values using encoding/json
+type JSONCodec[T any] struct{}
+
+// Marshal ...
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal ...
+func (JSONCodec[T]) Unmarshal(data []byte, v *T) error {
+	return json.Unmarshal(data, v)
+}
+
+// BinaryType are the types supported by BinaryCodec, including the types defined on them
+type BinaryType interface {
+	~string | ~[]byte | ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// BinaryCodec is a fast codec for strings, byte slices and integers.
+// Strings and byte slices are stored as is, integers as varints.
+type BinaryCodec[T BinaryType] struct{}
+
+// Marshal ...
+func (BinaryCodec[T]) Marshal(v T) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Slice:
+		return bytes.Clone(rv.Bytes()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(nil, rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(nil, rv.Uint()), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// Unmarshal ...
+func (BinaryCodec[T]) Unmarshal(data []byte, v *T) error {
+	rv := reflect.ValueOf(v).Elem()
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(string(data))
+	case reflect.Slice:
+		rv.SetBytes(bytes.Clone(data))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, n := binary.Varint(data)
+		if n <= 0 || n != len(data) || rv.OverflowInt(x) {
+			return ErrInvalidEncoding
+		}
+		rv.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, n := binary.Uvarint(data)
+		if n <= 0 || n != len(data) || rv.OverflowUint(x) {
+			return ErrInvalidEncoding
+		}
+		rv.SetUint(x)
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+// codecOr returns the codec given to the named option, or a GobCodec if the option is not set
+func codecOr[T any](name string, codec any) Codec[T] {
+	if codec == nil {
+		return GobCodec[T]{}
+	}
+	return typedOption[Codec[T]](name, codec)
+}
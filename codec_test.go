@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func roundTrip[T any](t *testing.T, codec Codec[T], v T) T {
+	data, err := codec.Marshal(v)
+	assert.NoError(t, err)
+	var out T
+	assert.NoError(t, codec.Unmarshal(data, &out))
+	return out
+}
+
+func TestGobCodec(t *testing.T) {
+	v := TestStruct{Num: 1, Children: []*TestStruct{{Num: 2}}}
+	assert.Equal(t, v, roundTrip[TestStruct](t, GobCodec[TestStruct]{}, v))
+	assert.Equal(t, 0, roundTrip[int](t, GobCodec[int]{}, 0))
+}
+
+func TestJSONCodec(t *testing.T) {
+	v := TestStruct{Num: 1, Children: []*TestStruct{{Num: 2}}}
+	assert.Equal(t, v, roundTrip[TestStruct](t, JSONCodec[TestStruct]{}, v))
+	var out int
+	assert.Error(t, JSONCodec[int]{}.Unmarshal([]byte("nope"), &out))
+}
+
+func TestBinaryCodec(t *testing.T) {
+	assert.Equal(t, "hello", roundTrip[string](t, BinaryCodec[string]{}, "hello"))
+	assert.Equal(t, []byte("hello"), roundTrip[[]byte](t, BinaryCodec[[]byte]{}, []byte("hello")))
+	assert.Equal(t, -42, roundTrip[int](t, BinaryCodec[int]{}, -42))
+	assert.Equal(t, int8(-128), roundTrip[int8](t, BinaryCodec[int8]{}, -128))
+	assert.Equal(t, int64(-1<<62), roundTrip[int64](t, BinaryCodec[int64]{}, -1<<62))
+	assert.Equal(t, uint16(65535), roundTrip[uint16](t, BinaryCodec[uint16]{}, 65535))
+	assert.Equal(t, uint64(1<<63), roundTrip[uint64](t, BinaryCodec[uint64]{}, 1<<63))
+	// The types defined on the supported types are supported too
+	type UserID string
+	type Payload []byte
+	type Port uint16
+	assert.Equal(t, UserID("user1"), roundTrip[UserID](t, BinaryCodec[UserID]{}, "user1"))
+	assert.Equal(t, Payload("hello"), roundTrip[Payload](t, BinaryCodec[Payload]{}, Payload("hello")))
+	assert.Equal(t, Port(8080), roundTrip[Port](t, BinaryCodec[Port]{}, 8080))
+
+	data, _ := BinaryCodec[int]{}.Marshal(1000)
+	var small int8
+	assert.ErrorIs(t, BinaryCodec[int8]{}.Unmarshal(data, &small), ErrInvalidEncoding)
+	var u uint
+	assert.ErrorIs(t, BinaryCodec[uint]{}.Unmarshal(nil, &u), ErrInvalidEncoding)
+}
+
+func TestSaveLoadWithCodecs(t *testing.T) {
+	c1 := NewWithKey[int, string](time.Minute, KeyCodec[int](BinaryCodec[int]{}), ValueCodec[string](JSONCodec[string]{}))
+	c1.Set(1, "val1")
+	c1.Set(2, "val2")
+	var buf bytes.Buffer
+	assert.NoError(t, c1.Save(&buf))
+	assert.Contains(t, buf.String(), `"val1"`)
+
+	c2 := NewWithKey[int, string](time.Minute, KeyCodec[int](BinaryCodec[int]{}), ValueCodec[string](JSONCodec[string]{}))
+	assert.NoError(t, c2.Load(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, c1.Len(), c2.Len())
+	v, _ := c2.Get(2)
+	assert.Equal(t, "val2", v)
+
+	// The snapshot cannot be decoded with the default codecs
+	c3 := NewWithKey[int, string](time.Minute)
+	assert.Error(t, c3.Load(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, 0, c3.Len())
+}
@@ -0,0 +1,117 @@
+package cache
+
+// Action tells Compute what to do with the item once the callback returns
+type Action int
+
+const (
+	// ComputeKeep leaves the item untouched
+	ComputeKeep Action = iota
+	// ComputeSet stores the value returned by the callback
+	ComputeSet
+	// ComputeDelete deletes the item
+	ComputeDelete
+)
+
+// Compute atomically reads, modifies and writes the item associated to the given key.
+// The callback receives the current value (found is false if the key does not exist or has expired)
+// and returns the new value along with the action to perform. With ComputeSet, the new value is
+// stored like Set would, using the given options.
+// Compute returns the value associated to the key once the action is performed.
+// The callback is executed while holding the cache lock, it must not call back into the cache.
+func (c *Cache[K, V]) Compute(k K, fn func(old V, found bool) (newV V, action Action), opts ...ItemOption) (value V, ok bool) {
+	return c.compute(k, fn, opts...)
+}
+
+// GetOrSet returns the existing value for the key if present and not expired. Otherwise, it stores and
+// returns the given value. The loaded result is true if the value was loaded, false if stored.
+func (c *Cache[K, V]) GetOrSet(k K, v V, opts ...ItemOption) (actual V, loaded bool) {
+	return c.getOrSet(k, v, opts...)
+}
+
+// Swap stores a value for the key and returns the previous value if any.
+// The loaded result reports whether the key was present and not expired.
+func (c *Cache[K, V]) Swap(k K, v V, opts ...ItemOption) (previous V, loaded bool) {
+	return c.swap(k, v, opts...)
+}
+
+// CompareAndSwap stores the new value for the key if the current value is equal to old.
+// Returns either or not the value was swapped.
+func CompareAndSwap[K, V comparable](c *Cache[K, V], k K, old, new V, opts ...ItemOption) (swapped bool) {
+	item := c.newItem(k, new, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if !found || current.value != old {
+			return current, ComputeKeep
+		}
+		swapped = true
+		return item, ComputeSet
+	})
+	return swapped
+}
+
+// CompareAndDelete deletes the item associated to the key if its value is equal to old.
+// Returns either or not the item was deleted.
+func CompareAndDelete[K, V comparable](c *Cache[K, V], k K, old V) (deleted bool) {
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if !found || current.value != old {
+			return current, ComputeKeep
+		}
+		deleted = true
+		return current, ComputeDelete
+	})
+	return deleted
+}
+
+func (c *Cache[K, V]) compute(k K, fn func(old V, found bool) (V, Action), opts ...ItemOption) (V, bool) {
+	item, ok := c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		newV, action := fn(current.value, found)
+		if action == ComputeSet {
+			return c.newItem(k, newV, opts...), ComputeSet
+		}
+		return current, action
+	})
+	return item.value, ok
+}
+
+func (c *Cache[K, V]) getOrSet(k K, v V, opts ...ItemOption) (actual V, loaded bool) {
+	item := c.newItem(k, v, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		if found {
+			actual, loaded = current.value, true
+			return current, ComputeKeep
+		}
+		actual = v
+		return item, ComputeSet
+	})
+	return actual, loaded
+}
+
+func (c *Cache[K, V]) swap(k K, v V, opts ...ItemOption) (previous V, loaded bool) {
+	item := c.newItem(k, v, opts...)
+	c.mutate(k, func(current Item[V], found bool) (Item[V], Action) {
+		previous, loaded = current.value, found
+		return item, ComputeSet
+	})
+	return previous, loaded
+}
+
+// mutate calls fn with the unexpired item associated to the key (a zero item if not found) and performs
+// the returned action, all while holding the items lock. Returns the item associated to the key afterward.
+func (c *Cache[K, V]) mutate(k K, fn func(current Item[V], found bool) (Item[V], Action)) (item Item[V], ok bool) {
+	now := c.nowNano()
+	var evicted []eviction[K, V]
+	s := c.shard(k)
+	s.with(func(st Store[K, V]) {
+		current, found := c.lookup(s, st, k, now, &evicted)
+		next, action := fn(current, found)
+		switch action {
+		case ComputeSet:
+			item, ok = c.store(s, st, k, next, now, &evicted), true
+		case ComputeDelete:
+			c.remove(s, st, k, now, Deleted, &evicted)
+		default:
+			item, ok = current, found
+		}
+	})
+	c.notifyEvicted(evicted)
+	return item, ok
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[[]string](time.Minute, WithClock(clock))
+	appendValue := func(s string) func([]string, bool) ([]string, Action) {
+		return func(old []string, found bool) ([]string, Action) {
+			return append(old, s), ComputeSet
+		}
+	}
+	v, ok := c.Compute("key1", appendValue("a"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a"}, v)
+	v, ok = c.Compute("key1", appendValue("b"), ExpireIn(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, v)
+
+	v, ok = c.Compute("key1", func(old []string, found bool) ([]string, Action) {
+		assert.True(t, found)
+		return nil, ComputeKeep
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, v)
+
+	clock.Advance(2 * time.Second)
+	v, ok = c.Compute("key1", func(old []string, found bool) ([]string, Action) {
+		assert.False(t, found)
+		assert.Nil(t, old)
+		return nil, ComputeKeep
+	})
+	assert.False(t, ok)
+	assert.Nil(t, v)
+
+	c.Set("key2", []string{"c"})
+	_, ok = c.Compute("key2", func(old []string, found bool) ([]string, Action) {
+		return nil, ComputeDelete
+	})
+	assert.False(t, ok)
+	assert.False(t, c.Has("key2"))
+}
+
+func TestComputeConcurrent(t *testing.T) {
+	c := New[int](time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Compute("key1", func(old int, found bool) (int, Action) {
+				return old + 1, ComputeSet
+			})
+		}()
+	}
+	wg.Wait()
+	v, _ := c.Get("key1")
+	assert.Equal(t, 100, v)
+}
+
+func TestGetOrSet(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[string](time.Minute, WithClock(clock))
+	actual, loaded := c.GetOrSet("key1", "val1", ExpireIn(time.Second))
+	assert.False(t, loaded)
+	assert.Equal(t, "val1", actual)
+	actual, loaded = c.GetOrSet("key1", "val2")
+	assert.True(t, loaded)
+	assert.Equal(t, "val1", actual)
+	clock.Advance(2 * time.Second)
+	actual, loaded = c.GetOrSet("key1", "val3")
+	assert.False(t, loaded)
+	assert.Equal(t, "val3", actual)
+}
+
+func TestSwap(t *testing.T) {
+	c := New[string](time.Minute)
+	previous, loaded := c.Swap("key1", "val1")
+	assert.False(t, loaded)
+	assert.Equal(t, "", previous)
+	previous, loaded = c.Swap("key1", "val2")
+	assert.True(t, loaded)
+	assert.Equal(t, "val1", previous)
+	assert.Equal(t, "val2", utils.First(c.Get("key1")))
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	c := New[string](time.Minute)
+	assert.False(t, CompareAndSwap(c, "key1", "", "val1"))
+	c.Set("key1", "val1")
+	assert.False(t, CompareAndSwap(c, "key1", "other", "val2"))
+	assert.True(t, CompareAndSwap(c, "key1", "val1", "val2"))
+	assert.Equal(t, "val2", utils.First(c.Get("key1")))
+	assert.False(t, CompareAndDelete(c, "key1", "val1"))
+	assert.True(t, CompareAndDelete(c, "key1", "val2"))
+	assert.False(t, c.Has("key1"))
+}
+
+func TestAddConcurrent(t *testing.T) {
+	c := New[int](time.Minute)
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	succeeded := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if c.Add("key1", i) == nil {
+				mtx.Lock()
+				succeeded++
+				mtx.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeeded)
+}
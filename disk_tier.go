@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"encoding/binary"
+	"github.com/alaingilbert/cache/internal/mtx"
+	"github.com/alaingilbert/cache/internal/segment"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+)
+
+// DefaultSegmentSize is the maximum size of a segment file of a DiskTier unless SegmentSize is used
+var DefaultSegmentSize int64 = 64 << 20
+
+// DiskTier keeps items in append-only segment files on the local disk, with an in-memory index of their position.
+// The files are compacted once they hold more replaced, deleted and expired items than live ones,
+// the expired items are only dropped by DeleteExpired (called by the cleanup of the cache it is the overflow of).
+// It is used as a second tier by a Cache, see Overflow, but it can also be used on its own.
+// Keys and values are encoded with the codecs given by KeyCodec and ValueCodec (GobCodec by default).
+type DiskTier[K comparable, V any] struct {
+	log        mtx.RWMtx[*segment.Log] // Mutex protected segment files
+	clock      clockwork.Clock         // Clock object for time related features
+	keyCodec   Codec[K]                // Encodes the keys
+	valueCodec Codec[V]                // Encodes the values
+	onError    func(error)             // Called with the errors of the methods that do not return them, nil ignores them
+}
+
+// OpenDiskTier opens the disk tier stored in dir, creating it if needed. The items it already holds are kept.
+// The options WithClock, KeyCodec, ValueCodec, SegmentSize and OnDiskError are supported, the others are ignored.
+// The codecs must match K and V, otherwise OpenDiskTier panics.
+func OpenDiskTier[K comparable, V any](dir string, opts ...Option) (*DiskTier[K, V], error) {
+	cfg := utils.BuildConfig(opts)
+	l, err := segment.Open(dir, utils.Or(cfg.segmentSize, DefaultSegmentSize))
+	if err != nil {
+		return nil, err
+	}
+	d := new(DiskTier[K, V])
+	d.log = mtx.NewRWMtx(l)
+	d.clock = utils.Or(cfg.clock, clockwork.NewRealClock())
+	d.keyCodec = codecOr[K]("KeyCodec", cfg.keyCodec)
+	d.valueCodec = codecOr[V]("ValueCodec", cfg.valueCodec)
+	d.onError = cfg.onDiskError
+	return d, nil
+}
+
+// Close the segment files, the tier must not be used afterward
+func (d *DiskTier[K, V]) Close() error {
+	return d.log.WithE(func(l **segment.Log) error { return (*l).Close() })
+}
+
+// Get a value associated to the given key
+func (d *DiskTier[K, V]) Get(k K) (value V, found bool) {
+	item, found := d.getItem(k)
+	if !found || item.isExpired(d.clock.Now().UnixNano()) {
+		return value, false
+	}
+	return item.value, true
+}
+
+// Set a key/value pair, only the expiration options are supported and the items never expire by default
+func (d *DiskTier[K, V]) Set(k K, v V, opts ...ItemOption) {
+	cfg := &ItemConfig{clock: d.clock}
+	utils.ApplyOptions(cfg, opts)
+	now := d.clock.Now().UnixNano()
+	item := Item[V]{value: v, created: now}
+	item.setTTL(now, utils.Or(cfg.d, NoExpiration), false)
+	d.handle(d.setItem(k, item))
+}
+
+// Delete an item
+func (d *DiskTier[K, V]) Delete(k K) {
+	d.handle(d.delete(k))
+}
+
+// DeleteExpired deletes the expired items, their space is reclaimed once the segment files are compacted
+func (d *DiskTier[K, V]) DeleteExpired() {
+	d.expire(d.clock.Now().UnixNano(), nil)
+}
+
+// DeleteAll deletes all items
+func (d *DiskTier[K, V]) DeleteAll() {
+	d.handle(d.log.WithE(func(l **segment.Log) error { return (*l).Clear() }))
+}
+
+// Len returns the number of items. This may include items that have expired,
+// but have not yet been cleaned up.
+func (d *DiskTier[K, V]) Len() (out int) {
+	d.log.RWith(func(l *segment.Log) { out = l.Len() })
+	return out
+}
+
+func (d *DiskTier[K, V]) handle(err error) {
+	if err != nil && d.onError != nil {
+		d.onError(err)
+	}
+}
+
+// getItem reads the item associated to the key, even if it has expired
+func (d *DiskTier[K, V]) getItem(k K) (item Item[V], found bool) {
+	key, err := d.keyCodec.Marshal(k)
+	if err != nil {
+		d.handle(err)
+		return item, false
+	}
+	var data []byte
+	err = d.log.RWithE(func(l *segment.Log) (err error) {
+		data, item.expiration, found, err = l.Get(key)
+		return err
+	})
+	if err == nil && found {
+		err = d.decodeItem(data, &item)
+	}
+	if err != nil {
+		d.handle(err)
+		return item, false
+	}
+	return item, found
+}
+
+// takeItem reads and deletes the item associated to the key, even if it has expired
+func (d *DiskTier[K, V]) takeItem(k K) (item Item[V], found bool) {
+	// Fast path, the caches call takeItem for every key they store when they report evictions
+	if d.Len() == 0 {
+		return item, false
+	}
+	if item, found = d.getItem(k); found {
+		d.handle(d.delete(k))
+	}
+	return item, found
+}
+
+// setItem writes the item, its expiration, cost, duration, creation time and version are kept
+func (d *DiskTier[K, V]) setItem(k K, item Item[V]) error {
+	key, err := d.keyCodec.Marshal(k)
+	if err != nil {
+		return err
+	}
+	value, err := d.valueCodec.Marshal(item.value)
+	if err != nil {
+		return err
+	}
+	data := binary.AppendVarint(nil, item.cost)
+	data = binary.AppendVarint(data, item.ttl)
+	data = binary.AppendVarint(data, item.created)
+	data = binary.AppendUvarint(data, item.version)
+	data = append(data, utils.Ternary[byte](item.sliding, 1, 0))
+	data = append(data, value...)
+	return d.log.WithE(func(l **segment.Log) error { return (*l).Put(key, data, item.expiration) })
+}
+
+// rangeItems calls fn with every item, even the expired ones. The items that cannot be decoded are skipped.
+func (d *DiskTier[K, V]) rangeItems(fn func(k K, item Item[V])) {
+	d.handle(d.log.RWithE(func(l *segment.Log) error {
+		return l.Range(func(key, value []byte, expiration int64) bool {
+			if k, item, err := d.decode(key, value, expiration); err != nil {
+				d.handle(err)
+			} else {
+				fn(k, item)
+			}
+			return true
+		})
+	}))
+}
+
+// expire deletes the items that expired before now, and returns their number.
+// If fn is not nil, it is called with every expired item that can be decoded.
+func (d *DiskTier[K, V]) expire(now int64, fn func(k K, item Item[V])) (n int) {
+	var onExpired func(key, value []byte, expiration int64)
+	if fn != nil {
+		onExpired = func(key, value []byte, expiration int64) {
+			if k, item, err := d.decode(key, value, expiration); err != nil {
+				d.handle(err)
+			} else {
+				fn(k, item)
+			}
+		}
+	}
+	d.handle(d.log.WithE(func(l **segment.Log) (err error) {
+		n, err = (*l).Expire(now, onExpired)
+		return err
+	}))
+	return n
+}
+
+func (d *DiskTier[K, V]) decode(key, value []byte, expiration int64) (k K, item Item[V], err error) {
+	if err = d.keyCodec.Unmarshal(key, &k); err != nil {
+		return k, item, err
+	}
+	item.expiration = expiration
+	return k, item, d.decodeItem(value, &item)
+}
+
+func (d *DiskTier[K, V]) decodeItem(data []byte, item *Item[V]) error {
+	var n int
+	for _, field := range []*int64{&item.cost, &item.ttl, &item.created} {
+		if *field, n = binary.Varint(data); n <= 0 {
+			return ErrInvalidEncoding
+		}
+		data = data[n:]
+	}
+	if item.version, n = binary.Uvarint(data); n <= 0 || len(data) == n {
+		return ErrInvalidEncoding
+	}
+	item.sliding = data[n] == 1
+	return d.valueCodec.Unmarshal(data[n+1:], &item.value)
+}
+
+func (d *DiskTier[K, V]) delete(k K) error {
+	// Fast path, the caches call delete for every key they store
+	if d.Len() == 0 {
+		return nil
+	}
+	key, err := d.keyCodec.Marshal(k)
+	if err != nil {
+		return err
+	}
+	// Most stored keys were never spilled, only take the write lock for the ones that were
+	var found bool
+	d.log.RWith(func(l *segment.Log) { found = l.Has(key) })
+	if !found {
+		return nil
+	}
+	return d.log.WithE(func(l **segment.Log) error { return (*l).Delete(key) })
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDiskTier(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	dir := t.TempDir()
+	d, err := OpenDiskTier[string, int](dir, WithClock(clock), ValueCodec[int](BinaryCodec[int]{}))
+	assert.NoError(t, err)
+	d.Set("key1", 1)
+	d.Set("key2", 2, ExpireIn(time.Minute))
+	d.Set("key3", 3)
+	d.Delete("key3")
+	assert.Equal(t, 2, d.Len())
+	value, found := d.Get("key1")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	_, found = d.Get("key3")
+	assert.False(t, found)
+
+	clock.Advance(2 * time.Minute)
+	_, found = d.Get("key2")
+	assert.False(t, found)
+	d.DeleteExpired()
+	assert.Equal(t, 1, d.Len())
+	assert.NoError(t, d.Close())
+
+	d, err = OpenDiskTier[string, int](dir, WithClock(clock), ValueCodec[int](BinaryCodec[int]{}))
+	assert.NoError(t, err)
+	defer d.Close()
+	value, found = d.Get("key1")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	d.DeleteAll()
+	assert.Equal(t, 0, d.Len())
+}
+
+func TestDiskTierError(t *testing.T) {
+	var errs []error
+	d, err := OpenDiskTier[string, int](t.TempDir(), ValueCodec[int](BinaryCodec[int]{}), OnDiskError(func(err error) {
+		errs = append(errs, err)
+	}))
+	assert.NoError(t, err)
+	d.Set("key1", 1)
+	assert.NoError(t, d.Close())
+	d.Set("key2", 2)
+	assert.Len(t, errs, 1)
+}
+
+func TestOverflow(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	d, err := OpenDiskTier[string, int](t.TempDir(), SegmentSize(1024))
+	assert.NoError(t, err)
+	defer d.Close()
+	var evicted []string
+	c := New[int](time.Minute, WithClock(clock), MaxItems(10), Overflow(d), OnEvicted(func(k string, _ int, reason EvictionReason) {
+		evicted = append(evicted, k+":"+reason.String())
+	}))
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i, utils.Ternary(i == 0, Sliding(time.Hour), ExpireIn(time.Hour)))
+	}
+	assert.Equal(t, 10, c.Len())
+	assert.Equal(t, 90, d.Len())
+	assert.Empty(t, evicted)
+
+	// A miss in memory promotes the item from disk, and evicts another one to disk
+	value, expiration, found := c.GetWithExpiration("key0")
+	assert.True(t, found)
+	assert.Equal(t, 0, value)
+	assert.True(t, clock.Now().Add(time.Hour).Equal(expiration))
+	assert.Equal(t, 10, c.Len())
+	assert.Equal(t, 90, d.Len())
+	_, found = d.Get("key0")
+	assert.False(t, found)
+
+	// Storing a key removes it from disk, and evicts another one to disk
+	c.Set("key1", 42)
+	assert.Equal(t, 90, d.Len())
+	_, found = d.Get("key1")
+	assert.False(t, found)
+	value, _ = c.Get("key1")
+	assert.Equal(t, 42, value)
+
+	c.Delete("key2")
+	assert.Equal(t, 89, d.Len())
+	assert.False(t, c.Has("key2"))
+
+	value, found = c.Take("key3")
+	assert.True(t, found)
+	assert.Equal(t, 3, value)
+	assert.False(t, c.Has("key3"))
+
+	clock.Advance(2 * time.Hour)
+	assert.False(t, c.Has("key4"))
+	assert.Greater(t, d.Len(), 0)
+	c.DeleteExpired()
+	assert.Equal(t, 0, d.Len())
+	c.DeleteAll()
+	assert.Equal(t, 0, d.Len())
+}
+
+func TestOverflowEvictions(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	d, err := OpenDiskTier[string, int](t.TempDir())
+	assert.NoError(t, err)
+	defer d.Close()
+	var evicted []string
+	c := New[int](time.Minute, WithClock(clock), MaxItems(1), Overflow(d), RecordStats, OnEvicted(func(k string, _ int, reason EvictionReason) {
+		evicted = append(evicted, k+":"+reason.String())
+	}))
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(k, 0)
+	}
+	assert.Equal(t, 4, d.Len())
+	c.Delete("a")
+	_, _ = c.Take("b")
+	c.Set("c", 1)
+	assert.Equal(t, []string{"a:deleted", "b:deleted", "c:replaced"}, evicted)
+
+	evicted = nil
+	clock.Advance(2 * time.Minute)
+	c.DeleteExpired()
+	assert.ElementsMatch(t, []string{"c:expired", "d:expired", "e:expired"}, evicted)
+	assert.Equal(t, 0, d.Len())
+
+	evicted = nil
+	c.Set("f", 0)
+	c.Set("g", 0)
+	c.DeleteAll()
+	assert.ElementsMatch(t, []string{"f:cleared", "g:cleared"}, evicted)
+	assert.Equal(t, map[EvictionReason]uint64{Deleted: 2, Replaced: 1, Expired: 3, Cleared: 2}, c.Stats().Evictions)
+}
+
+func TestOverflowAtomic(t *testing.T) {
+	d, err := OpenDiskTier[string, int](t.TempDir())
+	assert.NoError(t, err)
+	defer d.Close()
+	c := New[int](time.Minute, MaxItems(1), Overflow(d))
+	spill := func() {
+		c.Set("key1", 1)
+		c.Set("key2", 2)
+		assert.Equal(t, 1, d.Len())
+	}
+
+	spill()
+	assert.ErrorIs(t, c.Add("key1", 10), ErrItemAlreadyExists)
+	value, _ := c.Get("key1")
+	assert.Equal(t, 1, value)
+
+	spill()
+	assert.NoError(t, c.Replace("key1", 10))
+	value, _ = c.Get("key1")
+	assert.Equal(t, 10, value)
+
+	spill()
+	value, err = Increment(c, "key1", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, value)
+
+	spill()
+	value, ok := c.Compute("key1", func(old int, found bool) (int, Action) {
+		assert.True(t, found)
+		return old * 3, ComputeSet
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+}
+
+func TestOverflowVersion(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	d, err := OpenDiskTier[string, int](t.TempDir(), WithClock(clock))
+	assert.NoError(t, err)
+	defer d.Close()
+	c := New[int](time.Minute, WithClock(clock), MaxItems(1), Overflow(d))
+	c.Set("key1", 1)
+	created := clock.Now().UnixNano()
+	_, version, _ := c.GetWithVersion("key1")
+	clock.Advance(time.Second)
+	c.Set("key2", 2)
+	assert.Equal(t, 1, d.Len())
+
+	// Moving the item to disk and back is not a write
+	_, promoted, found := c.GetWithVersion("key1")
+	assert.True(t, found)
+	assert.Equal(t, version, promoted)
+	assert.Equal(t, created, utils.First(c.shards[0].load("key1")).created)
+	c.Set("key2", 2)
+	assert.NoError(t, c.SetIfVersion("key1", 10, version))
+	_, version, _ = c.GetWithVersion("key1")
+
+	// Items written directly to the tier get a version once in memory
+	d.Set("key3", 3)
+	_, version3, found := c.GetWithVersion("key3")
+	assert.True(t, found)
+	assert.Greater(t, version3, version)
+}
+
+func TestOverflowTypeMismatch(t *testing.T) {
+	d, err := OpenDiskTier[string, string](t.TempDir())
+	assert.NoError(t, err)
+	defer d.Close()
+	assert.Panics(t, func() { New[int](time.Minute, MaxItems(1), Overflow(d)) })
+	assert.Panics(t, func() { _, _ = OpenDiskTier[string, string](t.TempDir(), ValueCodec[int](JSONCodec[int]{})) })
+}
@@ -0,0 +1,49 @@
+package cache
+
+// EvictionReason tells why an item left the cache
+type EvictionReason int
+
+const (
+	// Expired the item expired and was removed by a cleanup, or overwritten
+	Expired EvictionReason = iota + 1
+	// Deleted the item was removed by Delete or Take
+	Deleted
+	// Replaced the item was overwritten by a new value
+	Replaced
+	// Capacity the item was evicted by the eviction policy to make room for other items
+	Capacity
+	// Cleared the item was removed by DeleteAll or Destroy
+	Cleared
+)
+
+// String ...
+func (r EvictionReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Deleted:
+		return "deleted"
+	case Replaced:
+		return "replaced"
+	case Capacity:
+		return "capacity"
+	case Cleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// eviction is an item that left the cache while the items lock was held,
+// the OnEvicted callback is called once the lock is released
+type eviction[K comparable, V any] struct {
+	k      K
+	v      V
+	reason EvictionReason
+}
+
+func (c *Cache[K, V]) notifyEvicted(evictions []eviction[K, V]) {
+	for _, ev := range evictions {
+		c.onEvicted(ev.k, ev.v, ev.reason)
+	}
+}
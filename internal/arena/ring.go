@@ -0,0 +1,179 @@
+// Package arena stores byte entries in large pre-allocated buffers, so that the garbage collector
+// does not have to scan them.
+package arena
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// headerSize is the size of the header of an entry: expiration (8), hash (8), key length (4), value length (4)
+const headerSize = 24
+
+// ErrEntryTooLarge is returned when an entry does not fit in the buffer of a ring
+var ErrEntryTooLarge = errors.New("entry too large")
+
+// Ring stores entries in a circular buffer, the oldest entries are overwritten when the buffer is full.
+// An entry that is replaced or deleted keeps its space until it is overwritten.
+// The index only holds integers, so it is not scanned by the garbage collector.
+// Ring is not safe for concurrent use.
+type Ring struct {
+	buf   []byte
+	head  uint64            // Logical position of the oldest entry
+	tail  uint64            // Logical position of the next entry
+	index map[uint64]uint32 // Hash of a key -> position of its entry in buf
+}
+
+// NewRing creates a ring with a buffer of the given size, capped to 4GiB
+func NewRing(size int) *Ring {
+	size = min(size, math.MaxUint32)
+	return &Ring{buf: make([]byte, size), index: make(map[uint64]uint32)}
+}
+
+// Len returns the number of live entries
+func (r *Ring) Len() int {
+	return len(r.index)
+}
+
+// Set appends an entry, evicting the oldest entries until it fits. A key is identified by its hash,
+// the entry of another key with the same hash is replaced.
+// A non-positive expiration (unix nano) means the entry never expires.
+func (r *Ring) Set(hash uint64, key, value []byte, expiration int64) error {
+	size := uint64(headerSize + len(key) + len(value))
+	if size > uint64(len(r.buf)) {
+		return ErrEntryTooLarge
+	}
+	for uint64(len(r.buf))-(r.tail-r.head) < size {
+		r.evictOldest()
+	}
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint64(header[0:], uint64(expiration))
+	binary.LittleEndian.PutUint64(header[8:], hash)
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(value)))
+	pos := r.tail
+	r.write(pos, header[:])
+	r.write(pos+headerSize, key)
+	r.write(pos+headerSize+uint64(len(key)), value)
+	r.tail += size
+	r.index[hash] = r.offset(pos)
+	return nil
+}
+
+// Get returns a copy of the value associated to the key, and its expiration
+func (r *Ring) Get(hash uint64, key []byte) (value []byte, expiration int64, found bool) {
+	off, found := r.lookup(hash, key)
+	if !found {
+		return nil, 0, false
+	}
+	h := r.header(uint64(off))
+	value = make([]byte, h.valueLen)
+	r.read(uint64(off)+headerSize+uint64(h.keyLen), value)
+	return value, h.expiration, true
+}
+
+// Delete removes the entry associated to the key, returns either or not it was found
+func (r *Ring) Delete(hash uint64, key []byte) bool {
+	if _, found := r.lookup(hash, key); !found {
+		return false
+	}
+	delete(r.index, hash)
+	return true
+}
+
+// DeleteExpired removes the entries that expired before now, returns the number of removed entries
+func (r *Ring) DeleteExpired(now int64) (n int) {
+	for pos := r.head; pos < r.tail; {
+		h := r.header(pos)
+		if h.expiration > 0 && h.expiration < now && r.live(pos, h) {
+			delete(r.index, h.hash)
+			n++
+		}
+		pos += h.size()
+	}
+	return n
+}
+
+// Clear removes all the entries
+func (r *Ring) Clear() {
+	r.head, r.tail = 0, 0
+	clear(r.index)
+}
+
+type header struct {
+	expiration int64
+	hash       uint64
+	keyLen     uint32
+	valueLen   uint32
+}
+
+func (h header) size() uint64 {
+	return headerSize + uint64(h.keyLen) + uint64(h.valueLen)
+}
+
+// lookup returns the position of the entry associated to the key
+func (r *Ring) lookup(hash uint64, key []byte) (uint32, bool) {
+	off, found := r.index[hash]
+	if !found {
+		return 0, false
+	}
+	h := r.header(uint64(off))
+	if h.keyLen != uint32(len(key)) {
+		return 0, false
+	}
+	// The key is compared in place, it can wrap around the end of the buffer
+	start := uint64(off) + headerSize
+	first := min(uint64(len(key)), uint64(len(r.buf))-r.offset64(start))
+	s := r.offset64(start)
+	if !bytes.Equal(r.buf[s:s+first], key[:first]) || !bytes.Equal(r.buf[:uint64(len(key))-first], key[first:]) {
+		return 0, false
+	}
+	return off, true
+}
+
+// live returns either or not the entry at the given logical position is the one in the index
+func (r *Ring) live(pos uint64, h header) bool {
+	off, found := r.index[h.hash]
+	return found && off == r.offset(pos)
+}
+
+func (r *Ring) evictOldest() {
+	h := r.header(r.head)
+	if r.live(r.head, h) {
+		delete(r.index, h.hash)
+	}
+	r.head += h.size()
+}
+
+func (r *Ring) header(pos uint64) header {
+	var b [headerSize]byte
+	r.read(pos, b[:])
+	return header{
+		expiration: int64(binary.LittleEndian.Uint64(b[0:])),
+		hash:       binary.LittleEndian.Uint64(b[8:]),
+		keyLen:     binary.LittleEndian.Uint32(b[16:]),
+		valueLen:   binary.LittleEndian.Uint32(b[20:]),
+	}
+}
+
+func (r *Ring) offset64(pos uint64) uint64 {
+	return pos % uint64(len(r.buf))
+}
+
+func (r *Ring) offset(pos uint64) uint32 {
+	return uint32(r.offset64(pos))
+}
+
+// read copies the bytes at the given position into dst, wrapping around the end of the buffer
+func (r *Ring) read(pos uint64, dst []byte) {
+	n := copy(dst, r.buf[r.offset64(pos):])
+	copy(dst[n:], r.buf)
+}
+
+// write copies src at the given position, wrapping around the end of the buffer
+func (r *Ring) write(pos uint64, src []byte) {
+	n := copy(r.buf[r.offset64(pos):], src)
+	copy(r.buf, src[n:])
+}
@@ -0,0 +1,65 @@
+package arena
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(1024)
+	assert.NoError(t, r.Set(1, []byte("key1"), []byte("val1"), 0))
+	assert.NoError(t, r.Set(2, []byte("key2"), []byte("val2"), 100))
+	value, expiration, found := r.Get(1, []byte("key1"))
+	assert.True(t, found)
+	assert.Equal(t, []byte("val1"), value)
+	assert.Equal(t, int64(0), expiration)
+	_, _, found = r.Get(1, []byte("other"))
+	assert.False(t, found)
+	_, _, found = r.Get(3, []byte("key3"))
+	assert.False(t, found)
+
+	assert.NoError(t, r.Set(1, []byte("key1"), []byte("new"), 0))
+	value, _, _ = r.Get(1, []byte("key1"))
+	assert.Equal(t, []byte("new"), value)
+	assert.Equal(t, 2, r.Len())
+
+	assert.False(t, r.Delete(1, []byte("other")))
+	assert.True(t, r.Delete(1, []byte("key1")))
+	assert.False(t, r.Delete(1, []byte("key1")))
+	assert.Equal(t, 1, r.Len())
+
+	assert.Equal(t, 0, r.DeleteExpired(50))
+	assert.Equal(t, 1, r.DeleteExpired(101))
+	assert.Equal(t, 0, r.Len())
+
+	assert.NoError(t, r.Set(1, []byte("key1"), []byte("val1"), 0))
+	r.Clear()
+	assert.Equal(t, 0, r.Len())
+	_, _, found = r.Get(1, []byte("key1"))
+	assert.False(t, found)
+}
+
+func TestRingTooLarge(t *testing.T) {
+	r := NewRing(32)
+	assert.ErrorIs(t, r.Set(1, []byte("key"), make([]byte, 8), 0), ErrEntryTooLarge)
+	assert.NoError(t, r.Set(1, []byte("key"), make([]byte, 5), 0))
+}
+
+func TestRingWrap(t *testing.T) {
+	// Every entry takes 24+5+5=34 bytes, so the ring holds 2 entries and they wrap around the buffer
+	r := NewRing(100)
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, r.Set(uint64(i), []byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("val%02d", i)), 0))
+		assert.LessOrEqual(t, r.Len(), 2)
+		value, _, found := r.Get(uint64(i), []byte(fmt.Sprintf("key%02d", i)))
+		assert.True(t, found)
+		assert.Equal(t, fmt.Sprintf("val%02d", i), string(value))
+	}
+	_, _, found := r.Get(47, []byte("key47"))
+	assert.False(t, found)
+	value, _, found := r.Get(48, []byte("key48"))
+	assert.True(t, found)
+	assert.Equal(t, "val48", string(value))
+	assert.Equal(t, 2, r.Len())
+}
@@ -0,0 +1,128 @@
+// Package expiry provides an index of expiration timestamps, so that expired keys can be found
+// without scanning every key.
+package expiry
+
+type entry[K comparable] struct {
+	key        K
+	expiration int64
+}
+
+// Heap is an indexed min-heap of keys ordered by expiration timestamp.
+// Every key is present at most once, its expiration can be updated in place.
+// Heap is not safe for concurrent use.
+type Heap[K comparable] struct {
+	entries []entry[K]
+	index   map[K]int // Position of each key in entries
+}
+
+// NewHeap creates a new empty heap
+func NewHeap[K comparable]() *Heap[K] {
+	return &Heap[K]{index: make(map[K]int)}
+}
+
+// Len returns the number of keys in the heap
+func (h *Heap[K]) Len() int {
+	return len(h.entries)
+}
+
+// Set inserts k or updates its expiration. A non-positive expiration means the key never
+// expires, and it is removed from the heap.
+func (h *Heap[K]) Set(k K, expiration int64) {
+	if expiration <= 0 {
+		h.Remove(k)
+		return
+	}
+	if i, ok := h.index[k]; ok {
+		old := h.entries[i].expiration
+		h.entries[i].expiration = expiration
+		if expiration < old {
+			h.up(i)
+		} else {
+			h.down(i)
+		}
+		return
+	}
+	h.entries = append(h.entries, entry[K]{key: k, expiration: expiration})
+	h.index[k] = len(h.entries) - 1
+	h.up(len(h.entries) - 1)
+}
+
+// Remove removes k from the heap
+func (h *Heap[K]) Remove(k K) {
+	i, ok := h.index[k]
+	if !ok {
+		return
+	}
+	last := len(h.entries) - 1
+	h.swap(i, last)
+	h.entries = h.entries[:last]
+	delete(h.index, k)
+	if i < last {
+		h.down(i)
+		h.up(i)
+	}
+}
+
+// Peek returns the key that expires first
+func (h *Heap[K]) Peek() (k K, expiration int64, ok bool) {
+	if len(h.entries) == 0 {
+		return k, 0, false
+	}
+	return h.entries[0].key, h.entries[0].expiration, true
+}
+
+// PopExpired removes and returns up to limit keys whose expiration is before now,
+// in expiration order. A non-positive limit means no limit.
+func (h *Heap[K]) PopExpired(now int64, limit int) (out []K) {
+	for len(h.entries) > 0 && h.entries[0].expiration < now && (limit <= 0 || len(out) < limit) {
+		k := h.entries[0].key
+		h.Remove(k)
+		out = append(out, k)
+	}
+	return out
+}
+
+// Clear removes all keys
+func (h *Heap[K]) Clear() {
+	h.entries = h.entries[:0]
+	clear(h.index)
+}
+
+func (h *Heap[K]) less(i, j int) bool {
+	return h.entries[i].expiration < h.entries[j].expiration
+}
+
+func (h *Heap[K]) swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].key] = i
+	h.index[h.entries[j].key] = j
+}
+
+func (h *Heap[K]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *Heap[K]) down(i int) {
+	n := len(h.entries)
+	for {
+		smallest := i
+		if l := 2*i + 1; l < n && h.less(l, smallest) {
+			smallest = l
+		}
+		if r := 2*i + 2; r < n && h.less(r, smallest) {
+			smallest = r
+		}
+		if smallest == i {
+			return
+		}
+		h.swap(i, smallest)
+		i = smallest
+	}
+}
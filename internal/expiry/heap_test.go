@@ -0,0 +1,69 @@
+package expiry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHeap(t *testing.T) {
+	h := NewHeap[string]()
+	h.Set("a", 30)
+	h.Set("b", 10)
+	h.Set("c", 20)
+	h.Set("d", -1)
+	assert.Equal(t, 3, h.Len())
+	k, expiration, ok := h.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	assert.Equal(t, int64(10), expiration)
+
+	h.Set("b", 40)
+	h.Set("a", 5)
+	assert.Equal(t, []string{"a", "c"}, h.PopExpired(25, 0))
+	assert.Equal(t, 1, h.Len())
+
+	h.Set("b", 0)
+	assert.Equal(t, 0, h.Len())
+	_, _, ok = h.Peek()
+	assert.False(t, ok)
+}
+
+func TestHeap_RemoveClear(t *testing.T) {
+	h := NewHeap[int]()
+	for i := 1; i <= 5; i++ {
+		h.Set(i, int64(i))
+	}
+	h.Remove(3)
+	h.Remove(42)
+	assert.Equal(t, []int{1, 2}, h.PopExpired(100, 2))
+	assert.Equal(t, []int{4, 5}, h.PopExpired(100, 0))
+	h.Set(1, 1)
+	h.Clear()
+	assert.Equal(t, 0, h.Len())
+	assert.Nil(t, h.PopExpired(100, 0))
+}
+
+func TestHeap_Random(t *testing.T) {
+	h := NewHeap[int]()
+	expected := map[int]int64{}
+	for i := 0; i < 1000; i++ {
+		k := rand.Intn(200)
+		switch rand.Intn(3) {
+		case 0, 1:
+			exp := rand.Int63n(1000) + 1
+			h.Set(k, exp)
+			expected[k] = exp
+		case 2:
+			h.Remove(k)
+			delete(expected, k)
+		}
+	}
+	assert.Equal(t, len(expected), h.Len())
+	popped := h.PopExpired(1001, 0)
+	assert.Len(t, popped, len(expected))
+	assert.True(t, sort.SliceIsSorted(popped, func(i, j int) bool {
+		return expected[popped[i]] < expected[popped[j]]
+	}))
+}
@@ -77,6 +77,49 @@ func (m *RWMtxMap[K, V]) LoadAndDelete(k K) (out V, loaded bool) {
 	return
 }
 
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value. The loaded result is true if the value was loaded, false if stored.
+func (m *RWMtxMap[K, V]) LoadOrStore(k K, v V) (actual V, loaded bool) {
+	m.With(func(m *map[K]V) {
+		if actual, loaded = (*m)[k]; !loaded {
+			(*m)[k], actual = v, v
+		}
+	})
+	return
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *RWMtxMap[K, V]) Swap(k K, v V) (previous V, loaded bool) {
+	m.With(func(m *map[K]V) {
+		previous, loaded = (*m)[k]
+		(*m)[k] = v
+	})
+	return
+}
+
+// CompareAndSwap swaps the old and new values for key if the value stored in the map is equal to old.
+func CompareAndSwap[K, V comparable](m *RWMtxMap[K, V], k K, old, new V) (swapped bool) {
+	m.With(func(m *map[K]V) {
+		if v, ok := (*m)[k]; ok && v == old {
+			(*m)[k] = new
+			swapped = true
+		}
+	})
+	return
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+func CompareAndDelete[K, V comparable](m *RWMtxMap[K, V], k K, old V) (deleted bool) {
+	m.With(func(m *map[K]V) {
+		if v, ok := (*m)[k]; ok && v == old {
+			delete(*m, k)
+			deleted = true
+		}
+	})
+	return
+}
+
 // Delete removes a key-value pair from the map.
 func (m *RWMtxMap[K, V]) Delete(k K) {
 	m.With(func(m *map[K]V) { delete(*m, k) })
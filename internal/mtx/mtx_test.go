@@ -104,3 +104,45 @@ func TestRWMtx_WithE(t *testing.T) {
 		t.Errorf("expected error")
 	}
 }
+
+func TestRWMtxMap_AtomicPrimitives(t *testing.T) {
+	m := NewRWMtxMap[string, int]()
+
+	actual, loaded := m.LoadOrStore("a", 1)
+	if loaded || actual != 1 {
+		t.Errorf("expected to store 1, got %d, loaded=%v", actual, loaded)
+	}
+	actual, loaded = m.LoadOrStore("a", 2)
+	if !loaded || actual != 1 {
+		t.Errorf("expected to load 1, got %d, loaded=%v", actual, loaded)
+	}
+
+	previous, loaded := m.Swap("a", 3)
+	if !loaded || previous != 1 {
+		t.Errorf("expected previous 1, got %d, loaded=%v", previous, loaded)
+	}
+	_, loaded = m.Swap("b", 4)
+	if loaded {
+		t.Errorf("expected key 'b' to not be loaded")
+	}
+
+	if CompareAndSwap(&m, "a", 1, 5) {
+		t.Errorf("expected swap to fail")
+	}
+	if !CompareAndSwap(&m, "a", 3, 5) {
+		t.Errorf("expected swap to succeed")
+	}
+	if CompareAndSwap(&m, "c", 0, 5) {
+		t.Errorf("expected swap of missing key to fail")
+	}
+
+	if CompareAndDelete(&m, "a", 3) {
+		t.Errorf("expected delete to fail")
+	}
+	if !CompareAndDelete(&m, "a", 5) {
+		t.Errorf("expected delete to succeed")
+	}
+	if m.Len() != 1 {
+		t.Errorf("expected length 1, got %d", m.Len())
+	}
+}
@@ -0,0 +1,160 @@
+package policy
+
+import "sync"
+
+// ARC implements the Adaptive Replacement Cache.
+// T1 holds keys seen once recently, T2 keys seen at least twice. B1 and B2 are ghost lists remembering
+// the keys recently evicted from T1 and T2, a hit in a ghost list adapts the target size p of T1,
+// which makes the policy self-tune between recency and frequency.
+type ARC[K comparable] struct {
+	mtx     sync.Mutex
+	c       int // Capacity
+	p       int // Target size of T1
+	t1, t2  *list[K]
+	b1, b2  *list[K]
+	items   map[K]*element[K]
+	adapted *element[K] // Ghost of the key being added, p has already been adapted to it by Evict
+}
+
+// NewARC creates a new ARC policy sized for capacity keys
+func NewARC[K comparable](capacity int) *ARC[K] {
+	return &ARC[K]{
+		c:     max(capacity, 1),
+		t1:    newList[K](),
+		t2:    newList[K](),
+		b1:    newList[K](),
+		b2:    newList[K](),
+		items: make(map[K]*element[K]),
+	}
+}
+
+// Add inserts k, adapting the target size of T1 when k is remembered by a ghost list
+func (p *ARC[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	adapted := p.adapted
+	p.adapted = nil
+	e, ok := p.items[k]
+	if !ok {
+		p.trimGhosts()
+		p.items[k] = p.t1.pushFront(&element[K]{key: k})
+		return
+	}
+	switch e.list {
+	case p.t1, p.t2:
+		p.promote(e)
+	case p.b1, p.b2:
+		if e != adapted {
+			p.adapt(e)
+		}
+		p.promote(e)
+	}
+}
+
+// Access moves k to the most recently used position of T2
+func (p *ARC[K]) Access(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok && (e.list == p.t1 || e.list == p.t2) {
+		p.promote(e)
+	}
+}
+
+// Remove forgets about k, without remembering it in a ghost list
+func (p *ARC[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		e.list.remove(e)
+		delete(p.items, k)
+		if e == p.adapted {
+			p.adapted = nil
+		}
+	}
+}
+
+// Evict moves the LRU key of T1 or T2 (depending on the target p) to its ghost list and returns it.
+// This is the REPLACE step of the paper, when the incoming key is remembered by a ghost list
+// the target p is adapted to it first.
+func (p *ARC[K]) Evict(incoming K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	ghostHit := false
+	if x, found := p.items[incoming]; found && (x.list == p.b1 || x.list == p.b2) {
+		if x != p.adapted {
+			p.adapt(x)
+			p.adapted = x
+		}
+		ghostHit = x.list == p.b2
+	}
+	var e *element[K]
+	if p.t1.len > 0 && (p.t1.len > p.p || (ghostHit && p.t1.len == p.p) || p.t2.len == 0) {
+		e = p.t1.back()
+		p.t1.remove(e)
+		p.b1.pushFront(e)
+	} else if p.t2.len > 0 {
+		e = p.t2.back()
+		p.t2.remove(e)
+		p.b2.pushFront(e)
+	} else {
+		return k, false
+	}
+	p.trimGhosts()
+	return e.key, true
+}
+
+// Clear forgets about all keys, ghosts included, and resets the adaptation
+func (p *ARC[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.t1.init()
+	p.t2.init()
+	p.b1.init()
+	p.b2.init()
+	p.p = 0
+	p.adapted = nil
+	clear(p.items)
+}
+
+// Len returns the number of resident keys tracked
+func (p *ARC[K]) Len() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.t1.len + p.t2.len
+}
+
+// adapt grows the target size of T1 for a hit in B1, and shrinks it for a hit in B2
+func (p *ARC[K]) adapt(e *element[K]) {
+	if e.list == p.b1 {
+		p.p = min(p.c, p.p+max(p.b2.len/p.b1.len, 1))
+	} else {
+		p.p = max(0, p.p-max(p.b1.len/p.b2.len, 1))
+	}
+}
+
+func (p *ARC[K]) promote(e *element[K]) {
+	e.list.remove(e)
+	p.t2.pushFront(e)
+}
+
+// trimGhosts keeps |T1|+|B1| <= c and the directory size |T1|+|T2|+|B1|+|B2| <= 2c
+func (p *ARC[K]) trimGhosts() {
+	for p.b1.len > 0 && p.t1.len+p.b1.len > p.c {
+		p.dropGhost(p.b1)
+	}
+	for p.b2.len > 0 && p.t1.len+p.t2.len+p.b1.len+p.b2.len > 2*p.c {
+		p.dropGhost(p.b2)
+	}
+	for p.b1.len > 0 && p.t1.len+p.t2.len+p.b1.len+p.b2.len > 2*p.c {
+		p.dropGhost(p.b1)
+	}
+}
+
+func (p *ARC[K]) dropGhost(l *list[K]) {
+	e := l.back()
+	l.remove(e)
+	delete(p.items, e.key)
+	if e == p.adapted {
+		p.adapted = nil
+	}
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestARC(t *testing.T) {
+	p := NewARC[string](2)
+	p.Add("a")
+	p.Add("b")
+	p.Access("a")
+	// "b" was seen once, "a" twice
+	k, ok := p.Evict("c")
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	assert.Equal(t, 1, p.Len())
+	assert.Equal(t, 1, p.b1.len)
+
+	// A hit in B1 grows the target size of T1
+	p.Add("b")
+	assert.Equal(t, 1, p.p)
+	assert.Equal(t, 2, p.t2.len)
+	assert.Equal(t, 0, p.b1.len)
+
+	// T1 is below its target size, the victim comes from T2
+	k, _ = p.Evict("c")
+	assert.Equal(t, "a", k)
+	assert.Equal(t, 1, p.b2.len)
+	p.Add("c")
+
+	// A hit in B2 shrinks the target size of T1 before the victim is chosen, and only once
+	k, _ = p.Evict("a")
+	assert.Equal(t, "c", k)
+	assert.Equal(t, 0, p.p)
+	p.Add("a")
+	assert.Equal(t, 0, p.p)
+	assert.Equal(t, []string{"b", "a"}, evictAll[string](p))
+}
+
+// The new key is never its own victim, even when T1 was empty
+func TestARC_NewKey(t *testing.T) {
+	p := NewARC[string](3)
+	for _, k := range []string{"a", "b", "c"} {
+		p.Add(k)
+		p.Access(k)
+	}
+	k, _ := p.Evict("d")
+	assert.Equal(t, "a", k)
+	p.Add("d")
+	assert.Equal(t, 1, p.t1.len)
+	// The target size of T1 is still 0, the next new key replaces "d"
+	k, _ = p.Evict("e")
+	assert.Equal(t, "d", k)
+}
+
+func TestARC_GhostsAreBounded(t *testing.T) {
+	p := NewARC[int](10)
+	for i := 0; i < 1000; i++ {
+		p.Add(i)
+		if i%3 == 0 {
+			p.Access(i)
+		}
+		for p.Len() > 10 {
+			_, ok := p.Evict(0)
+			assert.True(t, ok)
+		}
+	}
+	assert.Equal(t, 10, p.Len())
+	assert.LessOrEqual(t, len(p.items), 20)
+	assert.LessOrEqual(t, p.t1.len+p.b1.len, 10)
+}
+
+func TestARC_RemoveClear(t *testing.T) {
+	p := NewARC[int](4)
+	p.Add(1)
+	p.Add(2)
+	p.Access(2)
+	p.Access(3)
+	p.Remove(1)
+	p.Remove(3)
+	assert.Equal(t, 1, p.Len())
+	assert.Equal(t, []int{2}, evictAll[int](p))
+	assert.Equal(t, 1, p.b2.len)
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	assert.Equal(t, 0, len(p.items))
+	_, ok := p.Evict(0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,142 @@
+package policy
+
+import "sync"
+
+// freqNode is a bucket holding all the keys that have been used the same number of times
+type freqNode[K comparable] struct {
+	freq       int
+	items      *list[K]
+	prev, next *freqNode[K]
+}
+
+type lfuEntry[K comparable] struct {
+	elem   element[K]
+	bucket *freqNode[K]
+}
+
+// LFU evicts the least frequently used key, ties are broken by evicting the least recently used one.
+// Every operation runs in constant time thanks to a sorted list of frequency buckets.
+type LFU[K comparable] struct {
+	mtx   sync.Mutex
+	head  freqNode[K] // Sentinel, head.next is the bucket with the lowest frequency
+	items map[K]*lfuEntry[K]
+}
+
+// NewLFU creates a new LFU policy
+func NewLFU[K comparable]() *LFU[K] {
+	p := &LFU[K]{items: make(map[K]*lfuEntry[K])}
+	p.head.next = &p.head
+	p.head.prev = &p.head
+	return p
+}
+
+// Add inserts k with a frequency of one, or increments its frequency if already tracked
+func (p *LFU[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.increment(e)
+		return
+	}
+	b := p.head.next
+	if b == &p.head || b.freq != 1 {
+		b = p.insertBucketAfter(&p.head, 1)
+	}
+	e := &lfuEntry[K]{bucket: b}
+	e.elem.key = k
+	b.items.pushFront(&e.elem)
+	p.items[k] = e
+}
+
+// Access increments the frequency of k
+func (p *LFU[K]) Access(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.increment(e)
+	}
+}
+
+// Remove forgets about k
+func (p *LFU[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.unlink(e)
+		delete(p.items, k)
+	}
+}
+
+// Evict removes and returns the least frequently used key
+func (p *LFU[K]) Evict(K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	b := p.head.next
+	if b == &p.head {
+		return k, false
+	}
+	k = b.items.back().key
+	p.unlink(p.items[k])
+	delete(p.items, k)
+	return k, true
+}
+
+// Clear forgets about all keys
+func (p *LFU[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.head.next = &p.head
+	p.head.prev = &p.head
+	clear(p.items)
+}
+
+// Len returns the number of keys tracked
+func (p *LFU[K]) Len() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return len(p.items)
+}
+
+// Frequency returns the number of times k has been used, zero if it is not tracked
+func (p *LFU[K]) Frequency(k K) int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		return e.bucket.freq
+	}
+	return 0
+}
+
+func (p *LFU[K]) increment(e *lfuEntry[K]) {
+	b := e.bucket
+	next := b.next
+	if next == &p.head || next.freq != b.freq+1 {
+		next = p.insertBucketAfter(b, b.freq+1)
+	}
+	b.items.remove(&e.elem)
+	next.items.pushFront(&e.elem)
+	e.bucket = next
+	if b.items.len == 0 {
+		p.removeBucket(b)
+	}
+}
+
+func (p *LFU[K]) unlink(e *lfuEntry[K]) {
+	b := e.bucket
+	b.items.remove(&e.elem)
+	if b.items.len == 0 {
+		p.removeBucket(b)
+	}
+}
+
+func (p *LFU[K]) insertBucketAfter(at *freqNode[K], freq int) *freqNode[K] {
+	b := &freqNode[K]{freq: freq, items: newList[K](), prev: at, next: at.next}
+	at.next.prev = b
+	at.next = b
+	return b
+}
+
+func (p *LFU[K]) removeBucket(b *freqNode[K]) {
+	b.prev.next = b.next
+	b.next.prev = b.prev
+}
@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLFU(t *testing.T) {
+	p := NewLFU[string]()
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+	p.Access("a")
+	p.Access("c")
+	p.Access("missing")
+	assert.Equal(t, 3, p.Frequency("a"))
+	assert.Equal(t, 1, p.Frequency("b"))
+	assert.Equal(t, 2, p.Frequency("c"))
+	assert.Equal(t, 0, p.Frequency("missing"))
+	assert.Equal(t, []string{"b", "c", "a"}, evictAll[string](p))
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestLFU_TieBreak(t *testing.T) {
+	p := NewLFU[int]()
+	p.Add(1)
+	p.Add(2)
+	p.Add(3)
+	p.Access(1)
+	p.Access(2)
+	assert.Equal(t, []int{3, 1, 2}, evictAll[int](p))
+}
+
+func TestLFU_RemoveClear(t *testing.T) {
+	p := NewLFU[int]()
+	p.Add(1)
+	p.Add(2)
+	p.Add(1)
+	p.Remove(1)
+	p.Remove(4)
+	assert.Equal(t, 1, p.Len())
+	p.Add(3)
+	p.Access(3)
+	assert.Equal(t, []int{2, 3}, evictAll[int](p))
+	p.Add(1)
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	_, ok := p.Evict(0)
+	assert.False(t, ok)
+	p.Add(5)
+	assert.Equal(t, 1, p.Frequency(5))
+}
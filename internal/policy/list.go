@@ -0,0 +1,87 @@
+package policy
+
+// element is a node of an intrusive doubly linked list
+type element[K comparable] struct {
+	next, prev *element[K]
+	list       *list[K]
+	key        K
+}
+
+// list is a minimal doubly linked list of keys, the front being the most recent element
+type list[K comparable] struct {
+	root element[K]
+	len  int
+}
+
+func newList[K comparable]() *list[K] {
+	l := new(list[K])
+	return l.init()
+}
+
+func (l *list[K]) init() *list[K] {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+	return l
+}
+
+// front returns the first element of the list or nil if the list is empty
+func (l *list[K]) front() *element[K] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+// back returns the last element of the list or nil if the list is empty
+func (l *list[K]) back() *element[K] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+func (l *list[K]) insertAfter(e, at *element[K]) *element[K] {
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+	e.list = l
+	l.len++
+	return e
+}
+
+// pushFront inserts the element e at the front of the list
+func (l *list[K]) pushFront(e *element[K]) *element[K] {
+	return l.insertAfter(e, &l.root)
+}
+
+// remove unlinks e from the list
+func (l *list[K]) remove(e *element[K]) {
+	if e.list != l {
+		return
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.next = nil
+	e.prev = nil
+	e.list = nil
+	l.len--
+}
+
+// moveToFront moves e to the front of the list
+func (l *list[K]) moveToFront(e *element[K]) {
+	if e.list != l || l.root.next == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
+
+// prevOf returns the element before e (towards the front) or nil
+func (l *list[K]) prevOf(e *element[K]) *element[K] {
+	if e.prev == &l.root {
+		return nil
+	}
+	return e.prev
+}
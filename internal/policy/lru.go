@@ -0,0 +1,73 @@
+package policy
+
+import "sync"
+
+// LRU evicts the least recently used key
+type LRU[K comparable] struct {
+	mtx   sync.Mutex
+	ll    *list[K]
+	items map[K]*element[K]
+}
+
+// NewLRU creates a new LRU policy
+func NewLRU[K comparable]() *LRU[K] {
+	return &LRU[K]{ll: newList[K](), items: make(map[K]*element[K])}
+}
+
+// Add inserts k as the most recently used key
+func (p *LRU[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.ll.moveToFront(e)
+		return
+	}
+	p.items[k] = p.ll.pushFront(&element[K]{key: k})
+}
+
+// Access promotes k to the most recently used key
+func (p *LRU[K]) Access(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.ll.moveToFront(e)
+	}
+}
+
+// Remove forgets about k
+func (p *LRU[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		p.ll.remove(e)
+		delete(p.items, k)
+	}
+}
+
+// Evict removes and returns the least recently used key
+func (p *LRU[K]) Evict(K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e := p.ll.back()
+	if e == nil {
+		return k, false
+	}
+	p.ll.remove(e)
+	delete(p.items, e.key)
+	return e.key, true
+}
+
+// Clear forgets about all keys
+func (p *LRU[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.ll.init()
+	clear(p.items)
+}
+
+// Len returns the number of keys tracked
+func (p *LRU[K]) Len() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.ll.len
+}
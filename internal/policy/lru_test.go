@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func evictAll[K comparable](p Policy[K]) (out []K) {
+	var zero K
+	for {
+		k, ok := p.Evict(zero)
+		if !ok {
+			return out
+		}
+		out = append(out, k)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	p := NewLRU[string]()
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	assert.Equal(t, 3, p.Len())
+	p.Access("a")
+	p.Access("missing")
+	assert.Equal(t, []string{"b", "c", "a"}, evictAll[string](p))
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestLRU_AddExisting(t *testing.T) {
+	p := NewLRU[int]()
+	p.Add(1)
+	p.Add(2)
+	p.Add(1)
+	assert.Equal(t, 2, p.Len())
+	k, ok := p.Evict(0)
+	assert.True(t, ok)
+	assert.Equal(t, 2, k)
+}
+
+func TestLRU_RemoveClear(t *testing.T) {
+	p := NewLRU[int]()
+	p.Add(1)
+	p.Add(2)
+	p.Add(3)
+	p.Remove(2)
+	p.Remove(4)
+	assert.Equal(t, []int{1, 3}, evictAll[int](p))
+	p.Add(1)
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	_, ok := p.Evict(0)
+	assert.False(t, ok)
+}
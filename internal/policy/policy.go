@@ -0,0 +1,21 @@
+// Package policy provides the eviction policies used to bound the size of a cache.
+package policy
+
+// Policy keeps track of the keys of a bounded cache and decides which one should be evicted.
+// Implementations are safe for concurrent use.
+type Policy[K comparable] interface {
+	// Add records that k has been inserted or overwritten
+	Add(k K)
+	// Access records a cache hit for k
+	Access(k K)
+	// Remove forgets about k
+	Remove(k K)
+	// Evict forgets about the next victim and returns it, to make room for the incoming key.
+	// When a new key is stored, the cache makes room with Evict before calling Add,
+	// so that the new key is never its own victim.
+	Evict(incoming K) (k K, ok bool)
+	// Clear forgets about all keys
+	Clear()
+	// Len returns the number of keys tracked by the policy
+	Len() int
+}
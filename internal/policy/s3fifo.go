@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const s3FIFOMaxFreq = 3
+
+type s3FIFOEntry[K comparable] struct {
+	elem element[K]
+	freq atomic.Int32
+}
+
+// S3FIFO uses three FIFO queues: a small queue (10% of the capacity) filtering out one-hit wonders,
+// a main queue for the keys that proved useful, and a ghost queue remembering the keys recently
+// evicted from the small queue. Accesses only bump a small counter and hold a read lock.
+type S3FIFO[K comparable] struct {
+	mtx      sync.RWMutex
+	small    *list[K]
+	main     *list[K]
+	ghost    *list[K]
+	smallCap int
+	ghostCap int
+	items    map[K]*s3FIFOEntry[K]
+}
+
+// NewS3FIFO creates a new S3-FIFO policy sized for capacity keys
+func NewS3FIFO[K comparable](capacity int) *S3FIFO[K] {
+	capacity = max(capacity, 1)
+	smallCap := max(capacity/10, 1)
+	return &S3FIFO[K]{
+		small:    newList[K](),
+		main:     newList[K](),
+		ghost:    newList[K](),
+		smallCap: smallCap,
+		ghostCap: max(capacity-smallCap, 1),
+		items:    make(map[K]*s3FIFOEntry[K]),
+	}
+}
+
+// Add inserts k in the small queue, or in the main queue if it is remembered by the ghost queue
+func (p *S3FIFO[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	e, ok := p.items[k]
+	if !ok {
+		e = &s3FIFOEntry[K]{}
+		e.elem.key = k
+		p.small.pushFront(&e.elem)
+		p.items[k] = e
+		return
+	}
+	if e.elem.list == p.ghost {
+		p.ghost.remove(&e.elem)
+		e.freq.Store(0)
+		p.main.pushFront(&e.elem)
+		return
+	}
+	p.access(e)
+}
+
+// Access increments the (capped) frequency of k
+func (p *S3FIFO[K]) Access(k K) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if e, ok := p.items[k]; ok && e.elem.list != p.ghost {
+		p.access(e)
+	}
+}
+
+// Remove forgets about k
+func (p *S3FIFO[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		e.elem.list.remove(&e.elem)
+		delete(p.items, k)
+	}
+}
+
+// Evict removes and returns the next victim, keys that have been accessed are given another chance
+// by moving them from the small queue to the main queue, or back to the head of the main queue.
+// Like in the paper, it runs before the new key is added: a full small queue has smallCap keys.
+func (p *S3FIFO[K]) Evict(K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for {
+		if p.small.len > 0 && (p.small.len >= p.smallCap || p.main.len == 0) {
+			e := p.items[p.small.back().key]
+			p.small.remove(&e.elem)
+			if e.freq.Load() > 1 {
+				e.freq.Store(0)
+				p.main.pushFront(&e.elem)
+				continue
+			}
+			p.ghost.pushFront(&e.elem)
+			for p.ghost.len > p.ghostCap {
+				old := p.ghost.back()
+				p.ghost.remove(old)
+				delete(p.items, old.key)
+			}
+			return e.elem.key, true
+		} else if p.main.len > 0 {
+			e := p.items[p.main.back().key]
+			p.main.remove(&e.elem)
+			if freq := e.freq.Load(); freq > 0 {
+				e.freq.Store(freq - 1)
+				p.main.pushFront(&e.elem)
+				continue
+			}
+			delete(p.items, e.elem.key)
+			return e.elem.key, true
+		}
+		return k, false
+	}
+}
+
+// Clear forgets about all keys, ghosts included
+func (p *S3FIFO[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.small.init()
+	p.main.init()
+	p.ghost.init()
+	clear(p.items)
+}
+
+// Len returns the number of resident keys tracked
+func (p *S3FIFO[K]) Len() int {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.small.len + p.main.len
+}
+
+func (p *S3FIFO[K]) access(e *s3FIFOEntry[K]) {
+	for {
+		freq := e.freq.Load()
+		if freq >= s3FIFOMaxFreq || e.freq.CompareAndSwap(freq, freq+1) {
+			return
+		}
+	}
+}
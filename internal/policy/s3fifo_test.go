@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestS3FIFO(t *testing.T) {
+	p := NewS3FIFO[string](10)
+	p.Add("a")
+	p.Add("b")
+	p.Access("a")
+	p.Access("a")
+	p.Access("missing")
+	// "a" was accessed more than once and moves to the main queue, "b" goes to the ghost queue
+	k, ok := p.Evict("")
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	assert.Equal(t, 1, p.main.len)
+	assert.Equal(t, 1, p.ghost.len)
+	assert.Equal(t, 1, p.Len())
+
+	// "b" is remembered by the ghost queue and is inserted directly in the main queue
+	p.Add("b")
+	assert.Equal(t, 2, p.main.len)
+	assert.Equal(t, 0, p.ghost.len)
+	p.Access("b")
+	k, _ = p.Evict("")
+	assert.Equal(t, "a", k)
+	k, _ = p.Evict("")
+	assert.Equal(t, "b", k)
+	_, ok = p.Evict("")
+	assert.False(t, ok)
+}
+
+func TestS3FIFO_GhostIsBounded(t *testing.T) {
+	p := NewS3FIFO[int](10)
+	for i := 0; i < 100; i++ {
+		p.Add(i)
+		for p.Len() > 10 {
+			p.Evict(0)
+		}
+	}
+	assert.Equal(t, 10, p.Len())
+	assert.Equal(t, 9, p.ghost.len)
+}
+
+func TestS3FIFO_RemoveClear(t *testing.T) {
+	p := NewS3FIFO[int](10)
+	p.Add(1)
+	p.Add(2)
+	p.Add(2)
+	p.Remove(1)
+	p.Remove(3)
+	assert.Equal(t, 1, p.Len())
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	assert.Equal(t, 0, len(p.items))
+}
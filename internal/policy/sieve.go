@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type sieveEntry[K comparable] struct {
+	elem    element[K]
+	visited atomic.Bool
+}
+
+// SIEVE keeps keys in a FIFO queue and marks them as visited on access.
+// A hand sweeps the queue from the oldest to the newest key, clearing the visited bits,
+// and evicts the first key that has not been visited. Accesses only set a bit and hold a read lock.
+type SIEVE[K comparable] struct {
+	mtx   sync.RWMutex
+	queue *list[K]
+	hand  *element[K]
+	items map[K]*sieveEntry[K]
+}
+
+// NewSIEVE creates a new SIEVE policy
+func NewSIEVE[K comparable]() *SIEVE[K] {
+	return &SIEVE[K]{queue: newList[K](), items: make(map[K]*sieveEntry[K])}
+}
+
+// Add inserts k at the head of the queue, or marks it as visited if already tracked
+func (p *SIEVE[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		e.visited.Store(true)
+		return
+	}
+	e := &sieveEntry[K]{}
+	e.elem.key = k
+	p.queue.pushFront(&e.elem)
+	p.items[k] = e
+}
+
+// Access marks k as visited
+func (p *SIEVE[K]) Access(k K) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if e, ok := p.items[k]; ok && !e.visited.Load() {
+		e.visited.Store(true)
+	}
+}
+
+// Remove forgets about k
+func (p *SIEVE[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		if p.hand == &e.elem {
+			p.hand = p.queue.prevOf(p.hand)
+		}
+		p.queue.remove(&e.elem)
+		delete(p.items, k)
+	}
+}
+
+// Evict moves the hand to the first key that has not been visited, removes it and returns it
+func (p *SIEVE[K]) Evict(K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.queue.len == 0 {
+		return k, false
+	}
+	o := p.hand
+	if o == nil {
+		o = p.queue.back()
+	}
+	for {
+		e := p.items[o.key]
+		if !e.visited.Load() {
+			break
+		}
+		e.visited.Store(false)
+		if o = p.queue.prevOf(o); o == nil {
+			o = p.queue.back()
+		}
+	}
+	p.hand = p.queue.prevOf(o)
+	p.queue.remove(o)
+	delete(p.items, o.key)
+	return o.key, true
+}
+
+// Clear forgets about all keys
+func (p *SIEVE[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.queue.init()
+	p.hand = nil
+	clear(p.items)
+}
+
+// Len returns the number of keys tracked
+func (p *SIEVE[K]) Len() int {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return len(p.items)
+}
@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestSIEVE(t *testing.T) {
+	p := NewSIEVE[string]()
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+	p.Access("missing")
+	// "a" is visited, the hand skips it and clears its bit
+	k, ok := p.Evict("")
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	p.Add("d")
+	k, _ = p.Evict("")
+	assert.Equal(t, "c", k)
+	// The hand keeps moving towards the newest key, then wraps around to "a"
+	p.Access("d")
+	k, _ = p.Evict("")
+	assert.Equal(t, "a", k)
+	assert.Equal(t, 1, p.Len())
+}
+
+func TestSIEVE_RemoveHand(t *testing.T) {
+	p := NewSIEVE[int]()
+	p.Add(1)
+	p.Add(2)
+	p.Add(3)
+	p.Access(1)
+	k, _ := p.Evict(0)
+	assert.Equal(t, 2, k)
+	p.Remove(3)
+	p.Remove(4)
+	assert.Equal(t, []int{1}, evictAll[int](p))
+	p.Add(1)
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	_, ok := p.Evict(0)
+	assert.False(t, ok)
+}
+
+func TestSIEVE_ConcurrentAccess(t *testing.T) {
+	p := NewSIEVE[int]()
+	for i := 0; i < 100; i++ {
+		p.Add(i)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			p.Access(i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			p.Evict(0)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, p.Len())
+}
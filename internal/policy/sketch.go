@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"github.com/alaingilbert/cache/internal/utils"
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15 // Counters saturate like 4 bits counters would
+)
+
+// sketch is a Count-Min sketch estimating the access frequency of keys.
+// Counters are halved periodically so that old popularity fades away (aging).
+type sketch[K comparable] struct {
+	hash       func(k K) uint64
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newSketch[K comparable](capacity int) *sketch[K] {
+	capacity = max(capacity, 16)
+	width := uint64(1) << bits.Len(uint(4*capacity-1))
+	seed := maphash.MakeSeed()
+	hash := func(k K) uint64 { return utils.Hash(seed, k) }
+	s := &sketch[K]{hash: hash, mask: width - 1, sampleSize: 10 * capacity}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *sketch[K]) indexes(k K) (out [sketchDepth]uint64) {
+	h := s.hash(k)
+	h1, h2 := h&0xffffffff, h>>32
+	for i := range out {
+		out[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return out
+}
+
+// increment records an access to k
+func (s *sketch[K]) increment(k K) {
+	incremented := false
+	for i, idx := range s.indexes(k) {
+		if s.rows[i][idx] < sketchMaxCounter {
+			s.rows[i][idx]++
+			incremented = true
+		}
+	}
+	if incremented {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.reset()
+		}
+	}
+}
+
+// estimate returns the estimated access frequency of k
+func (s *sketch[K]) estimate(k K) uint8 {
+	out := uint8(sketchMaxCounter)
+	for i, idx := range s.indexes(k) {
+		out = min(out, s.rows[i][idx])
+	}
+	return out
+}
+
+// reset halves all counters
+func (s *sketch[K]) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *sketch[K]) clear() {
+	for i := range s.rows {
+		clear(s.rows[i])
+	}
+	s.additions = 0
+}
@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSketch(t *testing.T) {
+	s := newSketch[string](100)
+	assert.Equal(t, uint8(0), s.estimate("a"))
+	for i := 0; i < 5; i++ {
+		s.increment("a")
+	}
+	s.increment("b")
+	assert.Equal(t, uint8(5), s.estimate("a"))
+	assert.Equal(t, uint8(1), s.estimate("b"))
+	for i := 0; i < 50; i++ {
+		s.increment("a")
+	}
+	assert.Equal(t, uint8(sketchMaxCounter), s.estimate("a"))
+	s.reset()
+	assert.Equal(t, uint8(7), s.estimate("a"))
+	assert.Equal(t, uint8(0), s.estimate("b"))
+	s.clear()
+	assert.Equal(t, uint8(0), s.estimate("a"))
+}
+
+func TestSketch_Aging(t *testing.T) {
+	s := newSketch[int](16)
+	s.sampleSize = 20
+	for i := 0; i < 10; i++ {
+		s.increment(-1)
+	}
+	assert.Equal(t, uint8(10), s.estimate(-1))
+	for i := 0; i < 10; i++ {
+		s.increment(i)
+	}
+	assert.Less(t, s.additions, s.sampleSize)
+	assert.Less(t, s.estimate(-1), uint8(10))
+}
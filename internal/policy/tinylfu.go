@@ -0,0 +1,148 @@
+package policy
+
+import "sync"
+
+type tinyLFUEntry[K comparable] struct {
+	elem      element[K]
+	candidate bool // Entered the probation segment from the window and has not been judged by the admission filter yet
+}
+
+// TinyLFU implements W-TinyLFU.
+// New keys enter a small LRU window, keys leaving the window become candidates for the main segmented LRU
+// (probation + protected). When the cache is full, a Count-Min sketch decides if the candidate is worth
+// more than the probation victim, which keeps one-off keys from flushing out the popular ones.
+type TinyLFU[K comparable] struct {
+	mtx          sync.Mutex
+	window       *list[K]
+	probation    *list[K]
+	protected    *list[K]
+	windowCap    int
+	protectedCap int
+	sketch       *sketch[K]
+	items        map[K]*tinyLFUEntry[K]
+}
+
+// NewTinyLFU creates a new W-TinyLFU policy sized for capacity keys
+func NewTinyLFU[K comparable](capacity int) *TinyLFU[K] {
+	capacity = max(capacity, 1)
+	windowCap := max(capacity/100, 1)
+	mainCap := max(capacity-windowCap, 1)
+	return &TinyLFU[K]{
+		window:       newList[K](),
+		probation:    newList[K](),
+		protected:    newList[K](),
+		windowCap:    windowCap,
+		protectedCap: max(mainCap*8/10, 1),
+		sketch:       newSketch[K](capacity),
+		items:        make(map[K]*tinyLFUEntry[K]),
+	}
+}
+
+// Add inserts k in the window, or records an access if k is already tracked
+func (p *TinyLFU[K]) Add(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.sketch.increment(k)
+	if e, ok := p.items[k]; ok {
+		p.access(e)
+		return
+	}
+	e := &tinyLFUEntry[K]{}
+	e.elem.key = k
+	p.window.pushFront(&e.elem)
+	p.items[k] = e
+	for p.window.len > p.windowCap {
+		victim := p.items[p.window.back().key]
+		p.window.remove(&victim.elem)
+		p.probation.pushFront(&victim.elem)
+		victim.candidate = true
+	}
+}
+
+// SetHash replaces the hash of the frequency sketch, which is randomly seeded.
+// It is meant for tests, which need reproducible admission decisions.
+func (p *TinyLFU[K]) SetHash(hash func(k K) uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.sketch.hash = hash
+}
+
+// Access records a cache hit for k
+func (p *TinyLFU[K]) Access(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.sketch.increment(k)
+	if e, ok := p.items[k]; ok {
+		p.access(e)
+	}
+}
+
+// Remove forgets about k
+func (p *TinyLFU[K]) Remove(k K) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if e, ok := p.items[k]; ok {
+		e.elem.list.remove(&e.elem)
+		delete(p.items, k)
+	}
+}
+
+// Evict removes and returns the key that lost the admission challenge between the most recent
+// candidate and the probation victim.
+func (p *TinyLFU[K]) Evict(K) (k K, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	var e *tinyLFUEntry[K]
+	if victimElem := p.probation.back(); victimElem != nil {
+		e = p.items[victimElem.key]
+		if candidate := p.items[p.probation.front().key]; candidate.candidate && candidate != e {
+			candidate.candidate = false
+			if p.sketch.estimate(candidate.elem.key) <= p.sketch.estimate(e.elem.key) {
+				e = candidate
+			}
+		}
+	} else if victimElem = p.protected.back(); victimElem != nil {
+		e = p.items[victimElem.key]
+	} else if victimElem = p.window.back(); victimElem != nil {
+		e = p.items[victimElem.key]
+	} else {
+		return k, false
+	}
+	e.elem.list.remove(&e.elem)
+	delete(p.items, e.elem.key)
+	return e.elem.key, true
+}
+
+// Clear forgets about all keys, the frequency sketch included
+func (p *TinyLFU[K]) Clear() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.window.init()
+	p.probation.init()
+	p.protected.init()
+	p.sketch.clear()
+	clear(p.items)
+}
+
+// Len returns the number of keys tracked
+func (p *TinyLFU[K]) Len() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return len(p.items)
+}
+
+func (p *TinyLFU[K]) access(e *tinyLFUEntry[K]) {
+	switch e.elem.list {
+	case p.window, p.protected:
+		e.elem.list.moveToFront(&e.elem)
+	case p.probation:
+		e.candidate = false
+		p.probation.remove(&e.elem)
+		p.protected.pushFront(&e.elem)
+		for p.protected.len > p.protectedCap {
+			demoted := p.protected.back()
+			p.protected.remove(demoted)
+			p.probation.pushFront(demoted)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTinyLFU_RejectsOneHitWonders(t *testing.T) {
+	const capacity = 100
+	p := NewTinyLFU[int](capacity)
+	// The sketch is randomly seeded, a fixed hash makes the admission decisions reproducible
+	p.SetHash(fixedHash)
+	resident := map[int]struct{}{}
+	// Like a cache, make room before adding the key
+	add := func(k int) {
+		for len(resident) >= capacity {
+			victim, ok := p.Evict(k)
+			assert.True(t, ok)
+			delete(resident, victim)
+		}
+		p.Add(k)
+		resident[k] = struct{}{}
+	}
+	for k := 0; k < capacity; k++ {
+		add(k)
+		for i := 0; i < 5; i++ {
+			p.Access(k)
+		}
+	}
+	// A scan of one-off keys must not flush the popular ones
+	for k := 1000; k < 2000; k++ {
+		add(k)
+	}
+	hot := 0
+	for k := 0; k < capacity; k++ {
+		if _, ok := resident[k]; ok {
+			hot++
+		}
+	}
+	assert.GreaterOrEqual(t, hot, capacity*9/10)
+	assert.Equal(t, capacity, p.Len())
+}
+
+// fixedHash is the finalizer of splitmix64
+func fixedHash(k int) uint64 {
+	x := uint64(k)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func TestTinyLFU_RemoveClear(t *testing.T) {
+	p := NewTinyLFU[string](10)
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("b")
+	p.Access("missing")
+	p.Remove("c")
+	p.Remove("missing")
+	assert.Equal(t, 2, p.Len())
+	assert.ElementsMatch(t, []string{"a", "b"}, evictAll[string](p))
+	p.Add("a")
+	p.Clear()
+	assert.Equal(t, 0, p.Len())
+	_, ok := p.Evict("")
+	assert.False(t, ok)
+}
@@ -0,0 +1,389 @@
+// Package segment stores key/value records in append-only files on disk.
+package segment
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// headerSize is the size of the header of a record: crc (4), expiration (8), key length (4), value length (4)
+const headerSize = 20
+
+// tombstone is the value length of a record that deletes its key
+const tombstone = math.MaxUint32
+
+const segmentExt = ".seg"
+
+// ErrCorrupted is returned when a record does not match its checksum
+var ErrCorrupted = errors.New("corrupted record")
+
+// Log stores records in segment files that are only appended to, the position of the last record of every
+// key is kept in memory. A new segment is started once the current one reaches the maximum size, and the
+// segments are compacted once they hold more dead records than live ones.
+// Get can be called concurrently with itself, the other methods must not be called concurrently.
+type Log struct {
+	dir            string
+	maxSegmentSize int64
+	segments       map[uint32]*os.File
+	active         uint32              // Id of the segment that records are appended to
+	activeSize     int64               // Size of the active segment
+	index          map[string]location // Key -> last record of the key
+	liveSize       int64               // Total size of the records in the index
+	totalSize      int64               // Total size of the segments
+}
+
+type location struct {
+	segment    uint32
+	offset     int64
+	size       uint32
+	expiration int64
+}
+
+// Open opens the log stored in dir, creating it if needed. A segment that ends with a truncated or corrupted record
+// (after a crash) is truncated to its last valid record.
+func Open(dir string, maxSegmentSize int64) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, maxSegmentSize: maxSegmentSize, segments: make(map[uint32]*os.File), index: make(map[string]location)}
+	ids, err := l.segmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := l.openSegment(id); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Len returns the number of keys in the log
+func (l *Log) Len() int {
+	return len(l.index)
+}
+
+// Has returns either or not the key is in the log, without reading the disk
+func (l *Log) Has(key []byte) bool {
+	_, found := l.index[string(key)]
+	return found
+}
+
+// Get reads the value associated to the key, and its expiration
+func (l *Log) Get(key []byte) (value []byte, expiration int64, found bool, err error) {
+	loc, found := l.index[string(key)]
+	if !found {
+		return nil, 0, false, nil
+	}
+	if value, err = l.read(loc, key); err != nil {
+		return nil, 0, false, err
+	}
+	return value, loc.expiration, true, nil
+}
+
+// Put appends a record associating the value to the key.
+// A non-positive expiration (unix nano) means the record never expires.
+func (l *Log) Put(key, value []byte, expiration int64) error {
+	if uint64(len(value)) >= tombstone {
+		return fmt.Errorf("value too large: %d bytes", len(value))
+	}
+	loc, err := l.append(key, value, uint32(len(value)), expiration)
+	if err != nil {
+		return err
+	}
+	l.forget(key)
+	l.index[string(key)] = loc
+	l.liveSize += int64(loc.size)
+	return l.maybeCompact()
+}
+
+// Delete appends a record that deletes the key, if it is in the log
+func (l *Log) Delete(key []byte) error {
+	if !l.Has(key) {
+		return nil
+	}
+	if _, err := l.append(key, nil, tombstone, 0); err != nil {
+		return err
+	}
+	l.forget(key)
+	return l.maybeCompact()
+}
+
+// Range calls fn with the key, value and expiration of every record in the log, until fn returns false
+func (l *Log) Range(fn func(key, value []byte, expiration int64) bool) error {
+	for key, loc := range l.index {
+		value, err := l.read(loc, []byte(key))
+		if err != nil {
+			return err
+		}
+		if !fn([]byte(key), value, loc.expiration) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Expire forgets the records that expired before now, and returns their number. If fn is not nil,
+// it is called with every expired record before it is forgotten.
+// Their space is reclaimed by the next compaction, like the one of the deleted records.
+func (l *Log) Expire(now int64, fn func(key, value []byte, expiration int64)) (int, error) {
+	n := 0
+	for key, loc := range l.index {
+		if loc.expiration <= 0 || loc.expiration >= now {
+			continue
+		}
+		if fn != nil {
+			value, err := l.read(loc, []byte(key))
+			if err != nil {
+				return n, err
+			}
+			fn([]byte(key), value, loc.expiration)
+		}
+		l.liveSize -= int64(loc.size)
+		delete(l.index, key)
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, l.maybeCompact()
+}
+
+// Compact rewrites the live records into new segments and removes the old segments.
+// The records that expired before now are dropped, a non-positive now keeps them all.
+// The index is only replaced once all the records are copied, so a failed compaction
+// leaves the log as it was, and the old segments are removed from the oldest one, so
+// that a crash never keeps a record whose tombstone is gone.
+func (l *Log) Compact(now int64) (err error) {
+	oldIDs := slices.Sorted(maps.Keys(l.segments))
+	if err := l.rotate(); err != nil {
+		return err
+	}
+	index := make(map[string]location, len(l.index))
+	var liveSize int64
+	oldTotalSize := l.totalSize
+	l.totalSize = 0
+	defer func() {
+		if err != nil {
+			l.totalSize += oldTotalSize
+		}
+	}()
+	for key, loc := range l.index {
+		if now > 0 && loc.expiration > 0 && loc.expiration < now {
+			continue
+		}
+		value, err := l.read(loc, []byte(key))
+		if err != nil {
+			return err
+		}
+		newLoc, err := l.append([]byte(key), value, uint32(len(value)), loc.expiration)
+		if err != nil {
+			return err
+		}
+		index[key] = newLoc
+		liveSize += int64(newLoc.size)
+	}
+	l.index, l.liveSize = index, liveSize
+	for _, id := range oldIDs {
+		f := l.segments[id]
+		delete(l.segments, id)
+		_ = f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear removes all the records
+func (l *Log) Clear() error {
+	l.index = make(map[string]location)
+	l.liveSize = 0
+	return l.Compact(0)
+}
+
+// Close closes the segment files
+func (l *Log) Close() (err error) {
+	for _, f := range l.segments {
+		err = errors.Join(err, f.Close())
+	}
+	return err
+}
+
+// forget removes the key from the index, its record becomes dead
+func (l *Log) forget(key []byte) {
+	if loc, found := l.index[string(key)]; found {
+		l.liveSize -= int64(loc.size)
+		delete(l.index, string(key))
+	}
+}
+
+// maybeCompact compacts the log once the dead records take more space than the live ones, and than a segment
+func (l *Log) maybeCompact() error {
+	dead := l.totalSize - l.liveSize
+	if dead > l.liveSize && dead > l.maxSegmentSize {
+		return l.Compact(0)
+	}
+	return nil
+}
+
+// read reads the value of the record at the given location, and checks that it belongs to the key
+func (l *Log) read(loc location, key []byte) ([]byte, error) {
+	buf := make([]byte, loc.size)
+	if _, err := l.segments[loc.segment].ReadAt(buf, loc.offset); err != nil {
+		return nil, err
+	}
+	h := decodeHeader(buf)
+	if h.size() != int64(len(buf)) || crc32.ChecksumIEEE(buf[4:]) != h.crc || !bytes.Equal(buf[headerSize:headerSize+h.keyLen], key) {
+		return nil, ErrCorrupted
+	}
+	return buf[headerSize+h.keyLen:], nil
+}
+
+// append writes a record at the end of the active segment, starting a new segment if it is full
+func (l *Log) append(key, value []byte, valueLen uint32, expiration int64) (location, error) {
+	size := int64(headerSize + len(key) + len(value))
+	if l.activeSize > 0 && l.activeSize+size > l.maxSegmentSize {
+		if err := l.rotate(); err != nil {
+			return location{}, err
+		}
+	}
+	buf := make([]byte, size)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(expiration))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[16:], valueLen)
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf[0:], crc32.ChecksumIEEE(buf[4:]))
+	if _, err := l.segments[l.active].WriteAt(buf, l.activeSize); err != nil {
+		return location{}, err
+	}
+	loc := location{segment: l.active, offset: l.activeSize, size: uint32(size), expiration: expiration}
+	l.activeSize += size
+	l.totalSize += size
+	return loc, nil
+}
+
+// rotate starts a new segment
+func (l *Log) rotate() error {
+	id := l.active + 1
+	f, err := os.OpenFile(l.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	l.segments[id] = f
+	l.active, l.activeSize = id, 0
+	return nil
+}
+
+// openSegment reads the records of a segment into the index, and makes it the active segment
+func (l *Log) openSegment(id uint32) error {
+	f, err := os.OpenFile(l.segmentPath(id), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	l.segments[id] = f
+	l.active, l.activeSize = id, 0
+	r := bufio.NewReader(f)
+	for {
+		size, key, h, err := readRecord(r)
+		if err != nil {
+			// Drop a truncated or corrupted end of segment
+			if err := f.Truncate(l.activeSize); err != nil {
+				return err
+			}
+			return nil
+		}
+		l.forget(key)
+		if h.valueLen != tombstone {
+			l.index[string(key)] = location{segment: id, offset: l.activeSize, size: uint32(size), expiration: h.expiration}
+			l.liveSize += size
+		}
+		l.activeSize += size
+		l.totalSize += size
+	}
+}
+
+func (l *Log) segmentIDs() (ids []uint32, err error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+			ids = append(ids, uint32(id))
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (l *Log) segmentPath(id uint32) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%08d%s", id, segmentExt))
+}
+
+type header struct {
+	crc        uint32
+	expiration int64
+	keyLen     uint32
+	valueLen   uint32
+}
+
+// size returns the size of the record
+func (h header) size() int64 {
+	if h.valueLen == tombstone {
+		return headerSize + int64(h.keyLen)
+	}
+	return headerSize + int64(h.keyLen) + int64(h.valueLen)
+}
+
+// decodeHeader decodes the header at the beginning of buf, which must hold at least headerSize bytes
+func decodeHeader(buf []byte) (h header) {
+	h.crc = binary.LittleEndian.Uint32(buf[0:])
+	h.expiration = int64(binary.LittleEndian.Uint64(buf[4:]))
+	h.keyLen = binary.LittleEndian.Uint32(buf[12:])
+	h.valueLen = binary.LittleEndian.Uint32(buf[16:])
+	return h
+}
+
+// readRecord reads the next record of a segment, returns its size and its key
+func readRecord(r *bufio.Reader) (size int64, key []byte, h header, err error) {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, h, err
+	}
+	h = decodeHeader(buf)
+	if h.size() > math.MaxInt32 {
+		return 0, nil, h, ErrCorrupted
+	}
+	buf = append(buf, make([]byte, h.size()-headerSize)...)
+	if _, err := io.ReadFull(r, buf[headerSize:]); err != nil {
+		return 0, nil, h, err
+	}
+	if crc32.ChecksumIEEE(buf[4:]) != h.crc {
+		return 0, nil, h, ErrCorrupted
+	}
+	return int64(len(buf)), buf[headerSize : headerSize+h.keyLen], h, nil
+}
@@ -0,0 +1,173 @@
+package segment
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 1024)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Put([]byte("key1"), []byte("val1"), 0))
+	assert.NoError(t, l.Put([]byte("key2"), []byte("val2"), 42))
+	assert.NoError(t, l.Put([]byte("key1"), []byte("new1"), 0))
+	assert.Equal(t, 2, l.Len())
+	value, expiration, found, err := l.Get([]byte("key2"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("val2"), value)
+	assert.Equal(t, int64(42), expiration)
+	value, _, _, _ = l.Get([]byte("key1"))
+	assert.Equal(t, []byte("new1"), value)
+	_, _, found, err = l.Get([]byte("key3"))
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, l.Delete([]byte("key2")))
+	assert.NoError(t, l.Delete([]byte("key3")))
+	assert.False(t, l.Has([]byte("key2")))
+	assert.NoError(t, l.Close())
+
+	// The index is rebuilt from the segments
+	l, err = Open(dir, 1024)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, 1, l.Len())
+	value, _, found, _ = l.Get([]byte("key1"))
+	assert.True(t, found)
+	assert.Equal(t, []byte("new1"), value)
+	assert.False(t, l.Has([]byte("key2")))
+
+	assert.NoError(t, l.Clear())
+	assert.Equal(t, 0, l.Len())
+	assert.NoError(t, l.Put([]byte("key1"), []byte("val1"), 0))
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestLogSegments(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 256)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("val%d", i)), int64(i+1)))
+	}
+	assert.Greater(t, len(l.segments), 5)
+	// Overwriting every key makes the dead records take more space than the live ones
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("new%d", i)), int64(i+1)))
+	}
+	assert.LessOrEqual(t, l.totalSize-l.liveSize, max(l.liveSize, l.maxSegmentSize))
+	assert.NoError(t, l.Compact(51))
+	assert.Equal(t, 50, l.Len())
+	assert.Equal(t, l.liveSize, l.totalSize)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	assert.Len(t, files, len(l.segments))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(dir, 256)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, 50, l.Len())
+	for i := 50; i < 100; i++ {
+		value, expiration, found, err := l.Get([]byte(fmt.Sprintf("key%d", i)))
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, fmt.Sprintf("new%d", i), string(value))
+		assert.Equal(t, int64(i+1), expiration)
+	}
+}
+
+func TestLogExpire(t *testing.T) {
+	l, err := Open(t.TempDir(), 256)
+	assert.NoError(t, err)
+	defer l.Close()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("val%d", i)), int64(i+1)))
+	}
+	assert.NoError(t, l.Put([]byte("forever"), []byte("val"), 0))
+	n, err := l.Expire(0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	// The expired records take more space than the live ones, the segments are compacted
+	expired := map[string]string{}
+	n, err = l.Expire(91, func(key, value []byte, _ int64) { expired[string(key)] = string(value) })
+	assert.NoError(t, err)
+	assert.Equal(t, 90, n)
+	assert.Len(t, expired, 90)
+	assert.Equal(t, "val89", expired["key89"])
+	assert.Equal(t, 11, l.Len())
+	assert.False(t, l.Has([]byte("key89")))
+	assert.True(t, l.Has([]byte("key90")))
+	assert.Equal(t, l.liveSize, l.totalSize)
+
+	values := map[string]int64{}
+	assert.NoError(t, l.Range(func(key, value []byte, expiration int64) bool {
+		values[string(key)+"="+string(value)] = expiration
+		return true
+	}))
+	assert.Len(t, values, 11)
+	assert.Equal(t, int64(100), values["key99=val99"])
+	assert.Equal(t, int64(0), values["forever=val"])
+}
+
+func TestLogTruncated(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 1024)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Put([]byte("key1"), []byte("val1"), 0))
+	assert.NoError(t, l.Put([]byte("key2"), []byte("val2"), 0))
+	path := l.segments[l.active].Name()
+	size := l.activeSize
+	assert.NoError(t, l.Close())
+
+	// A crash while writing the last record leaves it incomplete
+	assert.NoError(t, os.Truncate(path, size-2))
+	l, err = Open(dir, 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Len())
+	assert.True(t, l.Has([]byte("key1")))
+	assert.NoError(t, l.Put([]byte("key3"), []byte("val3"), 0))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(dir, 1024)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, 2, l.Len())
+	value, _, _, err := l.Get([]byte("key3"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("val3"), value)
+}
+
+func TestLogCompactFailure(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 256)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("val%d", i)), 0))
+	}
+	liveSize, totalSize := l.liveSize, l.totalSize
+	// The records of a closed segment can no longer be read
+	_ = l.segments[l.index["key0"].segment].Close()
+	assert.Error(t, l.Compact(0))
+	// The index is left as it was
+	assert.Equal(t, 100, l.Len())
+	assert.Equal(t, liveSize, l.liveSize)
+	assert.Greater(t, l.totalSize, totalSize)
+	value, _, found, err := l.Get([]byte("key99"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("val99"), value)
+	_ = l.Close()
+
+	l, err = Open(dir, 256)
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, 100, l.Len())
+	value, _, found, _ = l.Get([]byte("key0"))
+	assert.True(t, found)
+	assert.Equal(t, []byte("val0"), value)
+}
@@ -0,0 +1,60 @@
+// Package singleflight provides a duplicate function call suppression mechanism.
+package singleflight
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPanicked is returned to the duplicate callers when the function panicked
+var ErrPanicked = errors.New("singleflight: function panicked")
+
+type call[V any] struct {
+	wg   sync.WaitGroup
+	val  V
+	err  error
+	dups int // Number of duplicate callers waiting for the result
+}
+
+// Group collapses concurrent calls for the same key into a single execution.
+// The zero value is ready to use.
+type Group[K comparable, V any] struct {
+	mtx   sync.Mutex
+	calls map[K]*call[V]
+}
+
+// Do executes fn, making sure that only one execution is in-flight for a given key at a time.
+// If a duplicate call comes in, the duplicate caller waits for the original to complete and receives the same results.
+func (g *Group[K, V]) Do(k K, fn func() (V, error)) (V, error) {
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	if c, ok := g.calls[k]; ok {
+		c.dups++
+		g.mtx.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &call[V]{err: ErrPanicked}
+	c.wg.Add(1)
+	g.calls[k] = c
+	g.mtx.Unlock()
+
+	defer func() {
+		g.mtx.Lock()
+		delete(g.calls, k)
+		g.mtx.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+// InFlight returns either or not a call is in-flight for the given key
+func (g *Group[K, V]) InFlight(k K) (ok bool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	_, ok = g.calls[k]
+	return
+}
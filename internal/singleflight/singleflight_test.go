@@ -0,0 +1,71 @@
+package singleflight
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func (g *Group[K, V]) dups(k K) int {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.calls[k].dups
+}
+
+func TestDo(t *testing.T) {
+	var g Group[string, int]
+	v, err := g.Do("key", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	someErr := errors.New("some error")
+	_, err = g.Do("key", func() (int, error) { return 0, someErr })
+	assert.ErrorIs(t, err, someErr)
+	assert.False(t, g.InFlight("key"))
+}
+
+func TestDoDeduplicates(t *testing.T) {
+	var g Group[string, int]
+	var calls atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_, _ = g.Do("key", func() (int, error) {
+			calls.Add(1)
+			close(started)
+			<-release
+			return 42, nil
+		})
+	}()
+	<-started
+	assert.True(t, g.InFlight("key"))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("key", func() (int, error) {
+				calls.Add(1)
+				return 0, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+		}()
+	}
+	for g.dups("key") < 10 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group[string, int]
+	assert.Panics(t, func() {
+		_, _ = g.Do("key", func() (int, error) { panic("boom") })
+	})
+	assert.False(t, g.InFlight("key"))
+}
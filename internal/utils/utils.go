@@ -1,6 +1,12 @@
 package utils
 
-import "reflect"
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"unsafe"
+)
 
 // Ptr ...
 func Ptr[T any](v T) *T { return &v }
@@ -78,3 +84,78 @@ func CastInto[T any](origin any, into *T) bool {
 	}
 	return false
 }
+
+// Hash returns the hash of a comparable value with the given seed, equal values have the same hash.
+// Like the == operator, it goes through the fields of structs and arrays, and compares pointers by address.
+// Strings, numbers, booleans and pointers, named types included, are hashed without allocating.
+func Hash[T comparable](seed maphash.Seed, v T) uint64 {
+	p := unsafe.Pointer(&v)
+	switch t := reflect.TypeFor[T](); t.Kind() {
+	case reflect.String:
+		return maphash.String(seed, *(*string)(p))
+	case reflect.Float32:
+		return hashUint64(seed, floatBits(float64(*(*float32)(p))))
+	case reflect.Float64:
+		return hashUint64(seed, floatBits(*(*float64)(p)))
+	case reflect.Struct, reflect.Array, reflect.Interface, reflect.Complex64, reflect.Complex128:
+		var h maphash.Hash
+		h.SetSeed(seed)
+		writeHash(&h, reflect.ValueOf(v))
+		return h.Sum64()
+	default:
+		// Integers, booleans and pointers are equal when their bits are
+		return maphash.Bytes(seed, unsafe.Slice((*byte)(p), t.Size()))
+	}
+}
+
+// writeHash writes the value to h, field by field for structs and arrays
+func writeHash(h *maphash.Hash, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		_, _ = h.WriteString(v.String())
+	case reflect.Struct:
+		for i := range v.NumField() {
+			writeHash(h, v.Field(i))
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			writeHash(h, v.Index(i))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			writeHash(h, v.Elem())
+		}
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeUint64(h, floatBits(real(c)))
+		writeUint64(h, floatBits(imag(c)))
+	case reflect.Float32, reflect.Float64:
+		writeUint64(h, floatBits(v.Float()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint64(h, v.Uint())
+	case reflect.Bool:
+		writeUint64(h, Ternary[uint64](v.Bool(), 1, 0))
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		writeUint64(h, uint64(v.Pointer()))
+	}
+}
+
+func hashUint64(seed maphash.Seed, u uint64) uint64 {
+	var buf [8]byte
+	return maphash.Bytes(seed, binary.LittleEndian.AppendUint64(buf[:0], u))
+}
+
+func writeUint64(h *maphash.Hash, u uint64) {
+	var buf [8]byte
+	_, _ = h.Write(binary.LittleEndian.AppendUint64(buf[:0], u))
+}
+
+func floatBits(f float64) uint64 {
+	// -0 is equal to +0
+	if f == 0 {
+		f = 0
+	}
+	return math.Float64bits(f)
+}
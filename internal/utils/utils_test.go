@@ -2,6 +2,8 @@ package utils
 
 import (
 	"github.com/stretchr/testify/assert"
+	"hash/maphash"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -104,3 +106,34 @@ func TestApplyOptions(t *testing.T) {
 	ApplyOptions(c, []func(*Config){Opt1, Opt2})
 	assert.Equal(t, &Config{A: "hello", B: "world"}, c)
 }
+
+func TestHash(t *testing.T) {
+	seed := maphash.MakeSeed()
+	assert.Equal(t, Hash(seed, "key1"), Hash(seed, "key1"))
+	assert.NotEqual(t, Hash(seed, "key1"), Hash(seed, "key2"))
+	assert.NotEqual(t, Hash(seed, 1), Hash(seed, 2))
+	assert.Equal(t, Hash(seed, 0.0), Hash(seed, math.Copysign(0, -1)))
+	type key struct {
+		A string
+		B int
+		F float64
+		I any
+	}
+	assert.Equal(t, Hash(seed, key{"a", 1, 0, nil}), Hash(seed, key{"a", 1, 0, nil}))
+	assert.NotEqual(t, Hash(seed, key{"a", 1, 0, nil}), Hash(seed, key{"a", 2, 0, nil}))
+	assert.Equal(t, Hash(seed, key{F: 0}), Hash(seed, key{F: math.Copysign(0, -1)}))
+	assert.Equal(t, Hash(seed, [2]any{1, key{A: "a"}}), Hash(seed, [2]any{1, key{A: "a"}}))
+	// Pointers are hashed by address, not by what they point to
+	p := &key{A: "a", B: 1}
+	h := Hash(seed, p)
+	p.B = 2
+	assert.Equal(t, h, Hash(seed, p))
+	assert.Equal(t, Hash(seed, any("key1")), Hash(seed, "key1"))
+	// Named types are hashed like their underlying type, without allocating
+	type userID int64
+	type name string
+	assert.Equal(t, Hash(seed, int64(42)), Hash(seed, userID(42)))
+	assert.Equal(t, Hash(seed, "key1"), Hash(seed, name("key1")))
+	assert.Equal(t, float64(0), testing.AllocsPerRun(10, func() { Hash(seed, userID(1<<40)) }))
+	assert.Equal(t, float64(0), testing.AllocsPerRun(10, func() { Hash(seed, name("key1")) }))
+}
@@ -6,6 +6,49 @@ import "time"
 type Item[V any] struct {
 	value      V
 	expiration int64
+	cost       int64
+	created    int64  // Unix (nano) timestamp of when the item was stored
+	version    uint64 // Incremented every time the item is written
+	ttl        int64  // Duration (nano) the item was stored with, NoExpiration if it never expires
+	sliding    bool   // Every read pushes the expiration forward by ttl
+}
+
+// ItemState is the state of an item, for the stores that serialize the items (see Store).
+// An item rebuilt from its state with NewItem is equal to the original item.
+type ItemState[V any] struct {
+	Value      V
+	Expiration int64         // Unix (nano) timestamp of the expiration, or a non-positive value if the item never expires
+	Cost       int64         // Cost of the item, see Weigher
+	Created    int64         // Unix (nano) timestamp of when the item was stored
+	Version    uint64        // Incremented every time the item is written
+	TTL        time.Duration // Duration the item was stored with, NoExpiration if it never expires
+	Sliding    bool          // Every read pushes the expiration forward by TTL
+}
+
+// NewItem rebuilds an item from its state
+func NewItem[V any](state ItemState[V]) Item[V] {
+	return Item[V]{
+		value:      state.Value,
+		expiration: state.Expiration,
+		cost:       state.Cost,
+		created:    state.Created,
+		version:    state.Version,
+		ttl:        int64(state.TTL),
+		sliding:    state.Sliding,
+	}
+}
+
+// State returns the state of the item, NewItem rebuilds the item from it
+func (i Item[V]) State() ItemState[V] {
+	return ItemState[V]{
+		Value:      i.value,
+		Expiration: i.expiration,
+		Cost:       i.cost,
+		Created:    i.created,
+		Version:    i.version,
+		TTL:        time.Duration(i.ttl),
+		Sliding:    i.sliding,
+	}
 }
 
 // Value returns the value contained by the item
@@ -18,6 +61,33 @@ func (i Item[V]) Expiration() time.Time {
 	return time.Unix(0, i.expiration)
 }
 
+// setTTL sets the expiration of the item to now + d
+func (i *Item[V]) setTTL(now int64, d time.Duration, sliding bool) {
+	i.ttl, i.sliding = int64(d), sliding
+	i.expiration = int64(NoExpiration)
+	if d != NoExpiration {
+		i.expiration = now + int64(d)
+	}
+}
+
+// Returns the expiration time, or a zero value if the item never expires
+func (i Item[V]) expirationTime() time.Time {
+	if i.expiration > 0 {
+		return i.Expiration()
+	}
+	return time.Time{}
+}
+
+// Cost returns the cost of the item
+func (i Item[V]) Cost() int64 {
+	return i.cost
+}
+
+// Version returns the version of the item, it changes every time the item is written
+func (i Item[V]) Version() uint64 {
+	return i.version
+}
+
 // IsExpired returns either or not the item is expired right now
 func (i Item[V]) IsExpired() bool {
 	now := time.Now().UnixNano()
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"github.com/alaingilbert/cache/internal/mtx"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Janitor runs the cleanup cycles of many caches from a single goroutine, or a small pool of workers,
+// instead of one goroutine per cache. See WithJanitor.
+type Janitor struct {
+	ctx             context.Context                   // Context is used to stop the janitor
+	cancel          context.CancelFunc                // Cancel the context and stop the janitor
+	clock           clockwork.Clock                   // Clock object for time related features
+	workers         int                               // Number of caches cleaned up concurrently
+	caches          mtx.RWMtxMap[uint64, func() bool] // Cleanup cycle of every registered cache, returns false once the cache is done
+	ids             atomic.Uint64                     // Last id given to a registered cache
+	cleanupEventsCh chan struct{}                     // Notifies that a cleanup cycle has been completed (for tests)
+}
+
+// JanitorConfig ...
+type JanitorConfig struct {
+	ctx     context.Context
+	clock   clockwork.Clock
+	workers int
+}
+
+// WithContext ...
+func (c *JanitorConfig) WithContext(ctx context.Context) *JanitorConfig {
+	if ctx != nil {
+		c.ctx = ctx
+	}
+	return c
+}
+
+// WithClock ...
+func (c *JanitorConfig) WithClock(clock clockwork.Clock) *JanitorConfig {
+	if clock != nil {
+		c.clock = clock
+	}
+	return c
+}
+
+// Workers ...
+func (c *JanitorConfig) Workers(n int) *JanitorConfig {
+	if n > 0 {
+		c.workers = n
+	}
+	return c
+}
+
+// JanitorOption ...
+type JanitorOption func(cfg *JanitorConfig)
+
+// JanitorContext changes the context of the janitor, it stops once the context is done
+func JanitorContext(ctx context.Context) JanitorOption {
+	return func(cfg *JanitorConfig) {
+		cfg = cfg.WithContext(ctx)
+	}
+}
+
+// JanitorClock changes the clock of the janitor
+func JanitorClock(clock clockwork.Clock) JanitorOption {
+	return func(cfg *JanitorConfig) {
+		cfg = cfg.WithClock(clock)
+	}
+}
+
+// JanitorWorkers sets the number of caches that are cleaned up concurrently (1 by default)
+func JanitorWorkers(n int) JanitorOption {
+	return func(cfg *JanitorConfig) {
+		cfg = cfg.Workers(n)
+	}
+}
+
+// NewJanitor creates a janitor that cleans up all its caches every cleanupInterval.
+// A zero interval uses DefaultCleanupInterval, and a negative one disables the cleanups.
+func NewJanitor(cleanupInterval time.Duration, opts ...JanitorOption) *Janitor {
+	cfg := utils.BuildConfig(opts)
+	cfg.ctx = utils.Or(cfg.ctx, context.Background())
+	cfg.clock = utils.Or(cfg.clock, clockwork.NewRealClock())
+	j := new(Janitor)
+	j.ctx, j.cancel = context.WithCancel(cfg.ctx)
+	j.clock = cfg.clock
+	j.workers = utils.Or(cfg.workers, 1)
+	j.caches = mtx.NewRWMtxMap[uint64, func() bool]()
+	j.cleanupEventsCh = make(chan struct{})
+	if cleanupInterval = utils.Or(cleanupInterval, DefaultCleanupInterval); cleanupInterval > 0 {
+		go j.run(cleanupInterval)
+	}
+	return j
+}
+
+// Stop the janitor, its caches are not cleaned up automatically anymore
+func (j *Janitor) Stop() {
+	j.cancel()
+}
+
+// Len returns the number of caches registered with the janitor
+func (j *Janitor) Len() int {
+	return j.caches.Len()
+}
+
+// register adds the cleanup cycle of a cache, the cache is deregistered once cleanup returns false
+func (j *Janitor) register(cleanup func() bool) (id uint64) {
+	id = j.ids.Add(1)
+	j.caches.Store(id, cleanup)
+	return id
+}
+
+func (j *Janitor) deregister(id uint64) {
+	j.caches.Delete(id)
+}
+
+func (j *Janitor) run(cleanupInterval time.Duration) {
+	for {
+		select {
+		case <-j.clock.After(cleanupInterval):
+		case <-j.ctx.Done():
+			return
+		}
+		j.sweep()
+		select {
+		case j.cleanupEventsCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sweep runs the cleanup cycle of every registered cache, on at most j.workers goroutines
+func (j *Janitor) sweep() {
+	var ids []uint64
+	j.caches.RWith(func(m map[uint64]func() bool) {
+		ids = make([]uint64, 0, len(m))
+		for id := range m {
+			ids = append(ids, id)
+		}
+	})
+	cleanup := func(id uint64) {
+		if fn, ok := j.caches.Load(id); ok && !fn() {
+			j.deregister(id)
+		}
+	}
+	if j.workers == 1 {
+		for _, id := range ids {
+			cleanup(id)
+		}
+		return
+	}
+	ch := make(chan uint64)
+	var wg sync.WaitGroup
+	for range min(j.workers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ch {
+				cleanup(id)
+			}
+		}()
+	}
+	for _, id := range ids {
+		ch <- id
+	}
+	close(ch)
+	wg.Wait()
+}
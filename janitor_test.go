@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			clock := clockwork.NewFakeClock()
+			j := NewJanitor(time.Minute, JanitorClock(clock), JanitorWorkers(workers))
+			defer j.Stop()
+			caches := make([]*Cache[string, int], 10)
+			for i := range caches {
+				caches[i] = New[int](time.Second, WithClock(clock), WithJanitor(j), RecordStats)
+				caches[i].Set("key1", 1)
+				caches[i].Set("key2", 2, NoExpire)
+			}
+			assert.Equal(t, 10, j.Len())
+			caches[0].Destroy()
+			assert.Equal(t, 9, j.Len())
+			clock.BlockUntil(1)
+			clock.Advance(time.Minute)
+			<-j.cleanupEventsCh
+			for _, c := range caches[1:] {
+				assert.Equal(t, 1, c.Len())
+				assert.Equal(t, uint64(1), c.Stats().CleanupCycles)
+			}
+		})
+	}
+}
+
+func TestJanitorCacheContext(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	j := NewJanitor(time.Minute, JanitorClock(clock))
+	defer j.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := New[int](time.Second, WithClock(clock), WithJanitor(j), WithContext(ctx))
+	c.Set("key1", 1)
+	assert.Equal(t, 1, j.Len())
+	cancel()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-j.cleanupEventsCh
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, 0, j.Len())
+}
+
+func TestJanitorDisabled(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	j := NewJanitor(-1, JanitorClock(clock))
+	defer j.Stop()
+	c := New[int](time.Second, WithClock(clock), WithJanitor(j))
+	c.Set("key1", 1)
+	clock.Advance(time.Minute)
+	select {
+	case <-j.cleanupEventsCh:
+		assert.Fail(t, "the janitor should not run")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Equal(t, 1, c.Len())
+	j.sweep()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestJanitorStop(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	j := NewJanitor(time.Minute, JanitorClock(clock))
+	clock.BlockUntil(1)
+	j.Stop()
+	clock.BlockUntil(0)
+}
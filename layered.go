@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"github.com/alaingilbert/cache/internal/utils"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// layeredLocks is the number of locks that serialize the writes of the keys of a Layered cache
+const layeredLocks = 64
+
+// Tier is a level of a Layered cache, Cache and DiskTier are tiers
+type Tier[K comparable, V any] interface {
+	Get(k K) (value V, found bool)
+	Set(k K, v V, opts ...ItemOption)
+	Delete(k K)
+}
+
+// WriteMode tells Layered which tiers receive the values that are set
+type WriteMode int
+
+const (
+	// WriteThrough sets the values in every tier
+	WriteThrough WriteMode = iota
+	// WriteAround sets the values in the last tier only, and deletes them from the other tiers.
+	// They reach the other tiers once they are read.
+	WriteAround
+)
+
+// LayeredConfig ...
+type LayeredConfig struct {
+	writeMode   WriteMode
+	promoteOpts []ItemOption
+}
+
+// WriteMode ...
+func (c *LayeredConfig) WriteMode(mode WriteMode) *LayeredConfig {
+	c.writeMode = mode
+	return c
+}
+
+// PromoteOptions ...
+func (c *LayeredConfig) PromoteOptions(opts ...ItemOption) *LayeredConfig {
+	c.promoteOpts = opts
+	return c
+}
+
+// LayeredOption ...
+type LayeredOption func(cfg *LayeredConfig)
+
+// WithWriteMode changes the tiers that receive the values that are set (WriteThrough by default)
+func WithWriteMode(mode WriteMode) LayeredOption {
+	return func(cfg *LayeredConfig) {
+		cfg = cfg.WriteMode(mode)
+	}
+}
+
+// PromoteOptions sets the options used to store a value in the upper tiers when it is found in a lower tier,
+// the default options of the tiers are used otherwise
+func PromoteOptions(opts ...ItemOption) LayeredOption {
+	return func(cfg *LayeredConfig) {
+		cfg = cfg.PromoteOptions(opts...)
+	}
+}
+
+// Layered composes several tiers, from the fastest to the largest. Get looks up the tiers in order and copies
+// a value found in a lower tier to the tiers above it. Delete removes the key from every tier.
+// The writes of a key, including the copies made by Get, are serialized so that a deleted value is never
+// copied back to an upper tier. Get does not block the writes while it looks up the lower tiers, the value it found
+// is only copied if no write happened in the meantime. Layered is itself a Tier.
+type Layered[K comparable, V any] struct {
+	tiers       []Tier[K, V]
+	writeMode   WriteMode
+	promoteOpts []ItemOption
+	seed        maphash.Seed
+	locks       [layeredLocks]sync.Mutex    // Serialize the writes of the keys, by hash
+	writes      [layeredLocks]atomic.Uint64 // Number of writes done under each lock
+}
+
+// NewLayered creates a cache composed of the given tiers, from the fastest to the largest
+func NewLayered[K comparable, V any](tiers []Tier[K, V], opts ...LayeredOption) *Layered[K, V] {
+	cfg := utils.BuildConfig(opts)
+	return &Layered[K, V]{tiers: tiers, writeMode: cfg.writeMode, promoteOpts: cfg.promoteOpts, seed: maphash.MakeSeed()}
+}
+
+// Get a value associated to the given key, from the first tier that has it
+func (l *Layered[K, V]) Get(k K) (value V, found bool) {
+	if len(l.tiers) == 0 {
+		return value, false
+	}
+	if value, found = l.tiers[0].Get(k); found {
+		return value, true
+	}
+	return l.promote(k)
+}
+
+// Has returns either or not the key is present in one of the tiers
+func (l *Layered[K, V]) Has(k K) bool {
+	return utils.Second(l.Get(k))
+}
+
+// Set a key/value pair according to the write mode, the options are given to every tier that receives the value
+func (l *Layered[K, V]) Set(k K, v V, opts ...ItemOption) {
+	if len(l.tiers) == 0 {
+		return
+	}
+	l.write(k, func() {
+		// The lower tiers are written first, so that an upper tier never holds a value that a lower tier does not
+		last := len(l.tiers) - 1
+		l.tiers[last].Set(k, v, opts...)
+		for i := last - 1; i >= 0; i-- {
+			if l.writeMode == WriteAround {
+				l.tiers[i].Delete(k)
+			} else {
+				l.tiers[i].Set(k, v, opts...)
+			}
+		}
+	})
+}
+
+// Delete an item from every tier
+func (l *Layered[K, V]) Delete(k K) {
+	l.write(k, func() {
+		for i := len(l.tiers) - 1; i >= 0; i-- {
+			l.tiers[i].Delete(k)
+		}
+	})
+}
+
+// promote looks up the lower tiers, and copies the value to the tiers above the one that has it.
+// The lookup is done without the lock, the copy is skipped if the key may have been written in the meantime.
+func (l *Layered[K, V]) promote(k K) (value V, found bool) {
+	i := l.lockIndex(k)
+	writes := l.writes[i].Load()
+	for j, tier := range l.tiers {
+		if value, found = tier.Get(k); found {
+			if j > 0 {
+				l.locks[i].Lock()
+				defer l.locks[i].Unlock()
+				if l.writes[i].Load() == writes {
+					for j := j - 1; j >= 0; j-- {
+						l.tiers[j].Set(k, value, l.promoteOpts...)
+					}
+				}
+			}
+			return value, true
+		}
+	}
+	return value, false
+}
+
+// write calls fn with the lock of the key held. The write is counted once fn returns,
+// so that a promote that looked up the tiers while fn was running does not copy what it found.
+func (l *Layered[K, V]) write(k K, fn func()) {
+	i := l.lockIndex(k)
+	l.locks[i].Lock()
+	defer l.locks[i].Unlock()
+	fn()
+	l.writes[i].Add(1)
+}
+
+func (l *Layered[K, V]) lockIndex(k K) uint64 {
+	return utils.Hash(l.seed, k) % layeredLocks
+}
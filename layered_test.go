@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ Tier[string, int] = (*Cache[string, int])(nil)
+	_ Tier[string, int] = (*DiskTier[string, int])(nil)
+	_ Tier[string, int] = (*Layered[string, int])(nil)
+)
+
+// remoteTier is a tier that counts its calls, like a remote cache would be
+type remoteTier struct {
+	mtx     sync.Mutex
+	items   map[string]int
+	gets    int
+	sets    int
+	deletes int
+}
+
+func newRemoteTier() *remoteTier {
+	return &remoteTier{items: make(map[string]int)}
+}
+
+func (r *remoteTier) Get(k string) (value int, found bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.gets++
+	value, found = r.items[k]
+	return
+}
+
+func (r *remoteTier) Set(k string, v int, _ ...ItemOption) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.sets++
+	r.items[k] = v
+}
+
+func (r *remoteTier) Delete(k string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.deletes++
+	delete(r.items, k)
+}
+
+func TestLayered(t *testing.T) {
+	l1 := New[int](time.Minute, MaxItems(2))
+	l2 := New[int](time.Minute, Shards(4))
+	remote := newRemoteTier()
+	l := NewLayered([]Tier[string, int]{l1, l2, remote})
+	l.Set("key1", 1)
+	assert.True(t, l1.Has("key1"))
+	assert.True(t, l2.Has("key1"))
+	assert.Equal(t, 1, remote.sets)
+
+	// A value found in a lower tier is copied to the tiers above it
+	remote.Set("key2", 2)
+	value, found := l.Get("key2")
+	assert.True(t, found)
+	assert.Equal(t, 2, value)
+	assert.True(t, l1.Has("key2"))
+	assert.True(t, l2.Has("key2"))
+	l.Get("key2")
+	assert.Equal(t, 1, remote.gets)
+
+	// Evicted from the first tier, still in the second one
+	l.Set("key3", 3)
+	assert.False(t, l1.Has("key1"))
+	assert.True(t, l.Has("key1"))
+	assert.Equal(t, 1, remote.gets)
+
+	l.Delete("key1")
+	assert.False(t, l1.Has("key1"))
+	assert.False(t, l2.Has("key1"))
+	assert.False(t, l.Has("key1"))
+	assert.Equal(t, 1, remote.deletes)
+
+	_, found = l.Get("key4")
+	assert.False(t, found)
+}
+
+func TestLayeredWriteAround(t *testing.T) {
+	l1 := New[int](time.Minute)
+	l2 := New[int](time.Minute)
+	l := NewLayered([]Tier[string, int]{l1, l2}, WithWriteMode(WriteAround), PromoteOptions(ExpireIn(time.Second)))
+	l1.Set("key1", 0)
+	l.Set("key1", 1)
+	assert.False(t, l1.Has("key1"))
+	assert.True(t, l2.Has("key1"))
+	value, _ := l.Get("key1")
+	assert.Equal(t, 1, value)
+	_, expiration, found := l1.GetWithExpiration("key1")
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Second), expiration, 500*time.Millisecond)
+}
+
+func TestLayeredEmpty(t *testing.T) {
+	l := NewLayered[string, int](nil)
+	l.Set("key1", 1)
+	l.Delete("key1")
+	assert.False(t, l.Has("key1"))
+}
+
+func TestLayeredConcurrentDelete(t *testing.T) {
+	l1 := New[int](time.Minute)
+	l2 := New[int](time.Minute)
+	l := NewLayered([]Tier[string, int]{l1, l2})
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key%d", i)
+		l2.Set(k, i)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			l.Get(k)
+		}()
+		go func() {
+			defer wg.Done()
+			l.Delete(k)
+		}()
+		wg.Wait()
+		// Whatever the order, the deleted value is not copied back to the first tier
+		assert.False(t, l.Has(k))
+	}
+}
+
+// gatedTier is a remote tier whose Get waits to be released
+type gatedTier struct {
+	*remoteTier
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedTier) Get(k string) (value int, found bool) {
+	g.entered <- struct{}{}
+	<-g.release
+	return g.remoteTier.Get(k)
+}
+
+func TestLayeredPromoteDoesNotBlockWrites(t *testing.T) {
+	l1 := New[int](time.Minute)
+	l2 := &gatedTier{remoteTier: newRemoteTier(), entered: make(chan struct{}), release: make(chan struct{})}
+	l := NewLayered([]Tier[string, int]{l1, l2})
+	l2.remoteTier.Set("key1", 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, found := l.Get("key1")
+		assert.True(t, found)
+		assert.Equal(t, 1, v)
+	}()
+	<-l2.entered
+	// The lower tier is looked up without the lock, the key can be written meanwhile
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		l.Delete("key1")
+	}()
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("the write waited for the lookup of the lower tier")
+	}
+	// The lookup finds a value that is stale, it is not copied to the first tier
+	l2.remoteTier.Set("key1", 1)
+	close(l2.release)
+	<-done
+	_, found := l1.Get("key1")
+	assert.False(t, found)
+}
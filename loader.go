@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Loader loads the value of a key that is missing from the cache
+type Loader[K comparable, V any] interface {
+	Load(ctx context.Context, k K) (V, error)
+}
+
+// LoaderFunc is an adapter to allow the use of an ordinary function as a Loader
+type LoaderFunc[K comparable, V any] func(ctx context.Context, k K) (V, error)
+
+// Load calls f(ctx, k)
+func (f LoaderFunc[K, V]) Load(ctx context.Context, k K) (V, error) {
+	return f(ctx, k)
+}
+
+func (c *Cache[K, V]) getWithExpirationOrLoad(k K) (V, time.Time, bool) {
+	var zero V
+	item, found := c.getItem(k, false)
+	c.stats.recordLookup(found)
+	if !found {
+		if c.loader == nil {
+			return zero, time.Time{}, false
+		}
+		var err error
+		if item, err = c.load(k); err != nil {
+			return zero, time.Time{}, false
+		}
+	} else if c.needsRefresh(k, item) {
+		go c.refresh(k, item)
+	}
+	return item.value, item.expirationTime(), true
+}
+
+// load calls the loader of the cache and stores the loaded value, concurrent loads of the same key are collapsed
+func (c *Cache[K, V]) load(k K) (Item[V], error) {
+	return c.loads.Do(k, func() (Item[V], error) {
+		value, err := c.timeLoad(func() (V, error) { return c.loader.Load(c.ctx, k) })
+		if err != nil {
+			return Item[V]{}, err
+		}
+		return c.set(k, value), nil
+	})
+}
+
+func (c *Cache[K, V]) needsRefresh(k K, item Item[V]) bool {
+	return c.loader != nil &&
+		c.refreshAfter > 0 &&
+		c.nowNano()-item.created > c.refreshAfter.Nanoseconds() &&
+		c.ctx.Err() == nil &&
+		!c.loads.InFlight(k)
+}
+
+// refresh reloads the item in the background, the new value is only stored if the item
+// has not been written or deleted in the meantime
+func (c *Cache[K, V]) refresh(k K, old Item[V]) {
+	_, _ = c.loads.Do(k, func() (Item[V], error) {
+		value, err := c.timeLoad(func() (V, error) { return c.loader.Load(c.ctx, k) })
+		if err != nil {
+			return old, err
+		}
+		item := c.newItem(k, value)
+		c.setItemIf(k, item, func(current Item[V], found bool) bool {
+			return found && current.version == old.version
+		})
+		return item, nil
+	})
+}
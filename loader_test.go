@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLoader(t *testing.T) {
+	var calls atomic.Int32
+	loader := LoaderFunc[string, int](func(ctx context.Context, k string) (int, error) {
+		calls.Add(1)
+		if k == "bad" {
+			return 0, errors.New("bad key")
+		}
+		return strconv.Atoi(k)
+	})
+	c := New[int](time.Minute, WithLoader[string, int](loader))
+	assert.False(t, c.Has("1"))
+	v, found := c.Get("1")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	assert.True(t, c.Has("1"))
+	v, expiration, found := c.GetWithExpiration("2")
+	assert.True(t, found)
+	assert.Equal(t, 2, v)
+	assert.False(t, expiration.IsZero())
+	_, found = c.Get("1")
+	assert.True(t, found)
+	_, found = c.Get("bad")
+	assert.False(t, found)
+	assert.False(t, c.Has("bad"))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRefreshAfter(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var version atomic.Int32
+	loader := LoaderFunc[string, int32](func(ctx context.Context, k string) (int32, error) {
+		return version.Add(1), nil
+	})
+	c := New[int32](time.Minute, WithClock(clock), WithLoader[string, int32](loader), RefreshAfter(10*time.Second))
+	v, _ := c.Get("key1")
+	assert.Equal(t, int32(1), v)
+	clock.Advance(5 * time.Second)
+	v, _ = c.Get("key1")
+	assert.Equal(t, int32(1), v)
+	clock.Advance(10 * time.Second)
+	// The old value is served while the item is reloaded in the background
+	v, _ = c.Get("key1")
+	assert.Equal(t, int32(1), v)
+	assert.Eventually(t, func() bool {
+		v, _ := c.shards[0].load("key1")
+		return v.value == 2
+	}, time.Second, time.Millisecond)
+	_, expiration, _ := c.GetWithExpiration("key1")
+	assert.True(t, clock.Now().Add(time.Minute).Equal(expiration))
+}
+
+func TestRefreshAfterDoesNotOverwrite(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	release := make(chan struct{})
+	loader := LoaderFunc[string, int](func(ctx context.Context, k string) (int, error) {
+		<-release
+		return 1, nil
+	})
+	c := New[int](time.Minute, WithClock(clock), WithLoader[string, int](loader), RefreshAfter(10*time.Second))
+	c.Set("key1", 0)
+	clock.Advance(11 * time.Second)
+	_, _ = c.Get("key1")
+	assert.Eventually(t, func() bool { return c.loads.InFlight("key1") }, time.Second, time.Millisecond)
+	c.Set("key1", 2)
+	close(release)
+	assert.Eventually(t, func() bool { return !c.loads.InFlight("key1") }, time.Second, time.Millisecond)
+	v, _ := c.Get("key1")
+	assert.Equal(t, 2, v)
+}
+
+func TestRefreshAfterDoesNotOverwriteIncrement(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	release := make(chan struct{})
+	loader := LoaderFunc[string, int](func(ctx context.Context, k string) (int, error) {
+		<-release
+		return 1, nil
+	})
+	c := New[int](time.Minute, WithClock(clock), WithLoader[string, int](loader), RefreshAfter(10*time.Second))
+	c.Set("key1", 10)
+	clock.Advance(11 * time.Second)
+	_, _ = c.Get("key1")
+	assert.Eventually(t, func() bool { return c.loads.InFlight("key1") }, time.Second, time.Millisecond)
+	// The item is written in place, it keeps its creation time
+	v, err := Increment(c, "key1", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, v)
+	close(release)
+	assert.Eventually(t, func() bool { return !c.loads.InFlight("key1") }, time.Second, time.Millisecond)
+	v, _ = c.Get("key1")
+	assert.Equal(t, 15, v)
+}
@@ -0,0 +1,32 @@
+package cache
+
+// Number are the types supported by Increment and Decrement
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Increment atomically adds n to the value associated to the given key, keeping its expiration.
+// Returns the new value, or ErrItemNotFound if the key does not exist or has expired.
+func Increment[K comparable, V Number](c *Cache[K, V], k K, n V) (V, error) {
+	return updateValue(c, k, func(v V) V { return v + n })
+}
+
+// Decrement atomically subtracts n from the value associated to the given key, keeping its expiration.
+// Returns the new value, or ErrItemNotFound if the key does not exist or has expired.
+func Decrement[K comparable, V Number](c *Cache[K, V], k K, n V) (V, error) {
+	return updateValue(c, k, func(v V) V { return v - n })
+}
+
+// updateValue replaces the value of an unexpired item under the items lock
+func updateValue[K comparable, V any](c *Cache[K, V], k K, fn func(V) V) (V, error) {
+	item, err := c.updateItem(k, func(item *Item[V]) {
+		item.value = fn(item.value)
+		item.version = c.versions.Add(1)
+	})
+	if err == nil {
+		c.shard(k).access(k)
+	}
+	return item.value, err
+}
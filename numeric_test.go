@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrementDecrement(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock))
+	_, err := Increment(c, "key1", 1)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+	c.Set("key1", 10, ExpireIn(10*time.Second))
+	_, expiration, _ := c.GetWithExpiration("key1")
+	clock.Advance(5 * time.Second)
+	v, err := Increment(c, "key1", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, v)
+	v, err = Decrement(c, "key1", 20)
+	assert.NoError(t, err)
+	assert.Equal(t, -5, v)
+	_, newExpiration, _ := c.GetWithExpiration("key1")
+	assert.Equal(t, expiration, newExpiration)
+	clock.Advance(6 * time.Second)
+	_, err = Decrement(c, "key1", 1)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+}
+
+func TestIncrementFloat(t *testing.T) {
+	c := New[float64](time.Minute)
+	c.Set("key1", 1.5)
+	v, err := Increment(c, "key1", 0.25)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.75, v)
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	c := New[uint64](time.Minute)
+	c.Set("key1", 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = Increment(c, "key1", 1)
+		}()
+	}
+	wg.Wait()
+	v, _ := c.Get("key1")
+	assert.Equal(t, uint64(100), v)
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/alaingilbert/cache/internal/utils"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LoadConfig ...
+type LoadConfig struct {
+	overwrite bool
+}
+
+// Overwrite ...
+func (c *LoadConfig) Overwrite(overwrite bool) *LoadConfig {
+	c.overwrite = overwrite
+	return c
+}
+
+// LoadOption ...
+type LoadOption func(cfg *LoadConfig)
+
+// Overwrite makes Load replace the existing items with the loaded ones,
+// by default the keys that already exist in the cache are skipped
+func Overwrite(cfg *LoadConfig) {
+	cfg = cfg.Overwrite(true)
+}
+
+// snapshotMagic starts every snapshot, the last byte is the version of the format
+var snapshotMagic = []byte("CACHE\x02")
+
+// maxSnapshotField caps the size of an encoded key or value, to protect against corrupted snapshots
+const maxSnapshotField = 1 << 30
+
+// Save writes all unexpired items of the cache to w, with their absolute expiration time and sliding duration.
+// Keys and values are encoded with the codecs of the cache, see KeyCodec and ValueCodec.
+func (c *Cache[K, V]) Save(w io.Writer) error {
+	return c.save(w)
+}
+
+// SaveFile saves the cache items to the given file, creating or replacing it.
+// The items are written to a temporary file that replaces the old one once complete,
+// so a failed save leaves the previous snapshot as it was.
+func (c *Cache[K, V]) SaveFile(path string) error {
+	return c.saveFile(path)
+}
+
+// Load adds the items saved by Save to the cache. Items that expired in the meantime are skipped,
+// the others keep their original expiration time.
+func (c *Cache[K, V]) Load(r io.Reader, opts ...LoadOption) error {
+	return c.restore(r, opts...)
+}
+
+// LoadFile loads the cache items from the given file
+func (c *Cache[K, V]) LoadFile(path string, opts ...LoadOption) error {
+	return c.restoreFile(path, opts...)
+}
+
+func (c *Cache[K, V]) save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotMagic); err != nil {
+		return err
+	}
+	var buf []byte
+	for k, item := range c.getItems() {
+		key, err := c.keyCodec.Marshal(k)
+		if err != nil {
+			return err
+		}
+		value, err := c.valueCodec.Marshal(item.value)
+		if err != nil {
+			return err
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+		buf = binary.AppendVarint(buf, item.expiration)
+		buf = binary.AppendVarint(buf, item.cost)
+		buf = binary.AppendVarint(buf, item.ttl)
+		buf = append(buf, utils.Ternary[byte](item.sliding, 1, 0))
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (c *Cache[K, V]) saveFile(path string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if err := f.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := c.save(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (c *Cache[K, V]) restore(r io.Reader, opts ...LoadOption) error {
+	cfg := utils.BuildConfig(opts)
+	entries, err := c.readSnapshot(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	now := c.nowNano()
+	byShard := make(map[*shard[K, V]][]snapshotEntry[K, V], len(c.shards))
+	for _, entry := range entries {
+		s := c.shard(entry.key)
+		byShard[s] = append(byShard[s], entry)
+	}
+	for _, s := range c.shards {
+		var evicted []eviction[K, V]
+		s.with(func(st Store[K, V]) {
+			for _, entry := range byShard[s] {
+				entry.item.created = now
+				if entry.item.isExpired(now) {
+					continue
+				}
+				if current, found := st.Load(entry.key); found && !current.isExpired(now) && !cfg.overwrite {
+					continue
+				}
+				c.store(s, st, entry.key, entry.item, now, &evicted)
+			}
+		})
+		c.notifyEvicted(evicted)
+	}
+	return nil
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	key  K
+	item Item[V]
+}
+
+// readSnapshot decodes all the entries before anything is stored, so that a corrupted snapshot is not partially loaded
+func (c *Cache[K, V]) readSnapshot(r *bufio.Reader) (entries []snapshotEntry[K, V], err error) {
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return nil, ErrInvalidEncoding
+	}
+	for {
+		if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		var entry snapshotEntry[K, V]
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.keyCodec.Unmarshal(key, &entry.key); err != nil {
+			return nil, err
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.valueCodec.Unmarshal(value, &entry.item.value); err != nil {
+			return nil, err
+		}
+		if entry.item.expiration, err = binary.ReadVarint(r); err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		if entry.item.cost, err = binary.ReadVarint(r); err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		if entry.item.ttl, err = binary.ReadVarint(r); err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		sliding, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		entry.item.sliding = sliding == 1
+		entries = append(entries, entry)
+	}
+}
+
+// readBytes reads a length prefixed byte slice
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > maxSnapshotField {
+		return nil, ErrInvalidEncoding
+	}
+	out := make([]byte, n)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, ErrInvalidEncoding
+	}
+	return out, nil
+}
+
+func (c *Cache[K, V]) restoreFile(path string, opts ...LoadOption) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.restore(f, opts...)
+}
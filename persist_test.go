@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	clock := clockwork.NewFakeClockAt(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	c1 := New[string](time.Minute, WithClock(clock))
+	c1.Set("key1", "val1")
+	c1.Set("key2", "val2", ExpireIn(10*time.Minute))
+	c1.Set("key3", "val3", NoExpire)
+	c1.Set("key4", "val4", ExpireIn(time.Second))
+	clock.Advance(2 * time.Second)
+	var buf bytes.Buffer
+	assert.NoError(t, c1.Save(&buf))
+
+	// Restarted process, key1 expired while on disk
+	clock.Advance(time.Minute)
+	c2 := New[string](time.Minute, WithClock(clock))
+	assert.NoError(t, c2.Load(&buf))
+	assert.Equal(t, 2, c2.Len())
+	assert.False(t, c2.Has("key1"))
+	_, expiration, found := c2.GetWithExpiration("key2")
+	assert.True(t, found)
+	assert.True(t, time.Date(2000, 1, 1, 0, 10, 0, 0, time.UTC).Equal(expiration))
+	_, expiration, found = c2.GetWithExpiration("key3")
+	assert.True(t, found)
+	assert.True(t, expiration.IsZero())
+}
+
+func TestSaveLoadSliding(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := clockwork.NewFakeClockAt(start)
+	c1 := New[string](time.Minute, WithClock(clock))
+	c1.Set("key1", "val1", Sliding(10*time.Minute))
+	c1.Set("key2", "val2", ExpireIn(10*time.Minute))
+	var buf bytes.Buffer
+	assert.NoError(t, c1.Save(&buf))
+
+	clock.Advance(time.Minute)
+	c2 := New[string](time.Minute, WithClock(clock))
+	assert.NoError(t, c2.Load(&buf))
+	// Reading a sliding item still pushes its expiration forward
+	_, expiration, found := c2.GetWithExpiration("key1")
+	assert.True(t, found)
+	assert.True(t, start.Add(11*time.Minute).Equal(expiration))
+	_, expiration, _ = c2.GetWithExpiration("key2")
+	assert.True(t, start.Add(10*time.Minute).Equal(expiration))
+
+	// Touch resets the expiration with the saved durations
+	clock.Advance(5 * time.Minute)
+	assert.NoError(t, c2.Touch("key1"))
+	assert.NoError(t, c2.Touch("key2"))
+	_, expiration, _ = c2.GetWithExpiration("key2")
+	assert.True(t, start.Add(16*time.Minute).Equal(expiration))
+	clock.Advance(9 * time.Minute)
+	_, expiration, found = c2.GetWithExpiration("key1")
+	assert.True(t, found)
+	assert.True(t, start.Add(25*time.Minute).Equal(expiration))
+}
+
+func TestLoadMergeOverwrite(t *testing.T) {
+	c1 := New[string](time.Minute)
+	c1.Set("key1", "saved1")
+	c1.Set("key2", "saved2")
+	var buf bytes.Buffer
+	assert.NoError(t, c1.Save(&buf))
+	snapshot := buf.Bytes()
+
+	c2 := New[string](time.Minute)
+	c2.Set("key1", "current1")
+	assert.NoError(t, c2.Load(bytes.NewReader(snapshot)))
+	assert.Equal(t, "current1", utils.First(c2.Get("key1")))
+	assert.Equal(t, "saved2", utils.First(c2.Get("key2")))
+
+	c3 := New[string](time.Minute)
+	c3.Set("key1", "current1")
+	assert.NoError(t, c3.Load(bytes.NewReader(snapshot), Overwrite))
+	assert.Equal(t, "saved1", utils.First(c3.Get("key1")))
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+	c1 := NewWithKey[int, []byte](time.Minute)
+	c1.Set(1, []byte("val1"), WithCost(4))
+	assert.NoError(t, c1.SaveFile(path))
+	c2 := NewWithKey[int, []byte](time.Minute)
+	assert.NoError(t, c2.LoadFile(path))
+	v, found := c2.Get(1)
+	assert.True(t, found)
+	assert.Equal(t, []byte("val1"), v)
+	assert.Equal(t, int64(4), c2.Cost())
+	assert.Error(t, c2.LoadFile(filepath.Join(t.TempDir(), "missing.gob")))
+	assert.Error(t, c2.Load(bytes.NewReader([]byte("garbage"))))
+}
+
+func TestSaveFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.json")
+	c1 := NewWithKey[int, float64](time.Minute, ValueCodec[float64](JSONCodec[float64]{}))
+	c1.Set(1, 1.5)
+	assert.NoError(t, c1.SaveFile(path))
+	// NaN cannot be encoded, the previous snapshot is kept
+	c1.Set(2, math.NaN())
+	assert.Error(t, c1.SaveFile(path))
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 1)
+	c2 := NewWithKey[int, float64](time.Minute, ValueCodec[float64](JSONCodec[float64]{}))
+	assert.NoError(t, c2.LoadFile(path))
+	assert.Equal(t, map[int]float64{1: 1.5}, itemValues(c2.Items()))
+}
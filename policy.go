@@ -0,0 +1,45 @@
+package cache
+
+import "github.com/alaingilbert/cache/internal/policy"
+
+// Policy is the algorithm used to choose which item to evict from a bounded cache
+type Policy int
+
+const (
+	// LRU evicts the least recently used item
+	LRU Policy = iota
+	// LFU evicts the least frequently used item, ties are broken by recency
+	LFU
+	// TinyLFU is W-TinyLFU, a small LRU window in front of a segmented LRU guarded by a frequency
+	// based admission filter. It keeps a good hit ratio when the traffic contains scans of one-off keys.
+	TinyLFU
+	// ARC is the Adaptive Replacement Cache, it self-tunes between recency and frequency
+	// using ghost lists of recently evicted keys
+	ARC
+	// SIEVE evicts the oldest item that has not been visited since the last sweep,
+	// reads only set a visited bit and never reorder a list
+	SIEVE
+	// S3FIFO uses a small FIFO queue to filter out one-hit wonders in front of a main FIFO queue,
+	// reads only bump a small counter and never reorder a list
+	S3FIFO
+)
+
+// maxCapacityHint caps the size of the policy structures of a cache bounded only by cost
+const maxCapacityHint = 1 << 16
+
+func newPolicy[K comparable](p Policy, capacity int) policy.Policy[K] {
+	switch p {
+	case LFU:
+		return policy.NewLFU[K]()
+	case TinyLFU:
+		return policy.NewTinyLFU[K](capacity)
+	case ARC:
+		return policy.NewARC[K](capacity)
+	case SIEVE:
+		return policy.NewSIEVE[K]()
+	case S3FIFO:
+		return policy.NewS3FIFO[K](capacity)
+	default:
+		return policy.NewLRU[K]()
+	}
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"github.com/alaingilbert/cache/internal/expiry"
+	"github.com/alaingilbert/cache/internal/mtx"
+	"github.com/alaingilbert/cache/internal/policy"
+	"github.com/alaingilbert/cache/internal/utils"
+	"math/bits"
+)
+
+// shard holds a part of the items of the cache, along with everything that is protected by its lock.
+// The capacity of a bounded cache is split evenly between its shards.
+type shard[K comparable, V any] struct {
+	items    mtx.RWMtx[Store[K, V]] // Mutex protected store that contains the items of the shard
+	maxItems int                    // Maximum number of items in the shard (0 means unbounded)
+	maxCost  int64                  // Maximum total cost of the items in the shard (0 means unbounded)
+	cost     int64                  // Total cost of the items in the shard, protected by the items lock
+	policy   policy.Policy[K]       // Eviction policy, nil if the cache is unbounded
+	expiry   *expiry.Heap[K]        // Index of the expiration timestamps, nil until it is built. Protected by the items lock
+}
+
+func newShard[K comparable, V any](store Store[K, V], maxItems int, maxCost int64, p Policy, indexed bool) *shard[K, V] {
+	s := &shard[K, V]{items: mtx.NewRWMtx(store), maxItems: maxItems, maxCost: maxCost}
+	if maxItems > 0 || maxCost > 0 {
+		s.policy = newPolicy[K](p, s.capacityHint())
+	}
+	if indexed {
+		s.expiry = expiry.NewHeap[K]()
+	}
+	return s
+}
+
+// capacityHint is the number of items the eviction policy should be sized for
+func (s *shard[K, V]) capacityHint() int {
+	if s.maxItems > 0 {
+		return s.maxItems
+	}
+	return int(min(s.maxCost, maxCapacityHint))
+}
+
+// overCapacity must be called with the items lock held
+func (s *shard[K, V]) overCapacity(st Store[K, V]) bool {
+	return (s.maxItems > 0 && st.Len() > s.maxItems) || (s.maxCost > 0 && s.cost > s.maxCost)
+}
+
+// overCapacityWith returns either or not adding an item of the given cost would put the shard over its capacity,
+// it must be called with the items lock held
+func (s *shard[K, V]) overCapacityWith(st Store[K, V], cost int64) bool {
+	return (s.maxItems > 0 && st.Len() >= s.maxItems) || (s.maxCost > 0 && s.cost+cost > s.maxCost)
+}
+
+// with executes a callback with the store of the shard, holding the items lock
+func (s *shard[K, V]) with(clb func(st Store[K, V])) {
+	s.items.With(func(st *Store[K, V]) { clb(*st) })
+}
+
+// rWith executes a read-only callback with the store of the shard, holding the items read lock
+func (s *shard[K, V]) rWith(clb func(st Store[K, V])) {
+	s.items.RWith(clb)
+}
+
+func (s *shard[K, V]) load(k K) (item Item[V], found bool) {
+	s.rWith(func(st Store[K, V]) { item, found = st.Load(k) })
+	return
+}
+
+func (s *shard[K, V]) len() (out int) {
+	s.rWith(func(st Store[K, V]) { out = st.Len() })
+	return
+}
+
+// access notifies the eviction policy that the key has been read
+func (s *shard[K, V]) access(k K) {
+	if s.policy != nil {
+		s.policy.Access(k)
+	}
+}
+
+// shardCount rounds n up to a power of two
+func shardCount(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// shard returns the shard that holds the given key
+func (c *Cache[K, V]) shard(k K) *shard[K, V] {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[utils.Hash(c.seed, k)&uint64(len(c.shards)-1)]
+}
+
+// splitCapacity returns the share of a capacity for each of n shards, rounded up
+func splitCapacity[T int | int64](capacity T, n int) T {
+	return (capacity + T(n) - 1) / T(n)
+}
+
+// buildExpirationIndex indexes all the items of the shard, it must be called with the items lock held
+func (s *shard[K, V]) buildExpirationIndex(st Store[K, V]) {
+	s.expiry = expiry.NewHeap[K]()
+	st.Range(func(k K, item Item[V]) bool {
+		s.indexExpiration(k, item)
+		return true
+	})
+}
+
+// indexExpiration updates the expiration index if the shard has one, it must be called with the items lock held
+func (s *shard[K, V]) indexExpiration(k K, item Item[V]) {
+	if s.expiry != nil {
+		s.expiry.Set(k, item.expiration)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alaingilbert/cache/internal/utils"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardCount(t *testing.T) {
+	assert.Equal(t, 1, shardCount(0))
+	assert.Equal(t, 1, shardCount(1))
+	assert.Equal(t, 2, shardCount(2))
+	assert.Equal(t, 4, shardCount(3))
+	assert.Equal(t, 64, shardCount(64))
+	assert.Equal(t, 128, shardCount(65))
+}
+
+func TestShards(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), Shards(6))
+	assert.Len(t, c.shards, 8)
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i, ExpireIn(utils.Ternary(i%2 == 0, time.Second, time.Hour)))
+	}
+	assert.Equal(t, 100, c.Len())
+	assert.Equal(t, int64(100), c.Cost())
+	for _, s := range c.shards {
+		assert.Greater(t, s.len(), 0)
+	}
+	clock.Advance(time.Minute)
+	assert.Len(t, c.Items(), 50)
+	c.DeleteExpired()
+	assert.Equal(t, 50, c.Len())
+	value, found := c.Get("key1")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	c.DeleteAll()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, int64(0), c.Cost())
+}
+
+func TestShardsEqualKeys(t *testing.T) {
+	type key struct{ F float64 }
+	c := NewWithKey[key, int](time.Minute, Shards(64))
+	c.Set(key{0}, 1)
+	c.Set(key{math.Copysign(0, -1)}, 2)
+	assert.Equal(t, 1, c.Len())
+	value, _ := c.Get(key{0})
+	assert.Equal(t, 2, value)
+}
+
+func TestShardsMaxItems(t *testing.T) {
+	c := New[int](time.Minute, Shards(4), MaxItems(40))
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+	for _, s := range c.shards {
+		assert.Equal(t, 10, s.len())
+	}
+	assert.Equal(t, 40, c.Len())
+}
+
+func TestShardsConcurrent(t *testing.T) {
+	c := NewWithKey[int, int](time.Minute, Shards(16), MaxItems(500))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Set(g*1000+i, i)
+				c.Get(i)
+				_, _ = Increment(c, g*1000+i, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, c.Len(), 512)
+}
+
+func TestShardsSaveLoad(t *testing.T) {
+	c := New[int](time.Minute, Shards(4))
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, c.Save(&buf))
+	c2 := New[int](time.Minute, Shards(8))
+	assert.NoError(t, c2.Load(&buf))
+	assert.Equal(t, c.Len(), c2.Len())
+	value, found := c2.Get("key42")
+	assert.True(t, found)
+	assert.Equal(t, 42, value)
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of a cache
+type Stats struct {
+	Hits             uint64                    // Number of lookups that found an unexpired item
+	Misses           uint64                    // Number of lookups that did not find an unexpired item
+	Loads            uint64                    // Number of successful loader calls
+	LoadFailures     uint64                    // Number of loader calls that returned an error
+	TotalLoadTime    time.Duration             // Time spent in the loader calls
+	Evictions        map[EvictionReason]uint64 // Number of items that left the cache, by reason
+	Expirations      uint64                    // Number of expired items removed by DeleteExpired or the auto-cleanup
+	CleanupCycles    uint64                    // Number of auto-cleanup cycles
+	TotalCleanupTime time.Duration             // Time spent in the auto-cleanup cycles
+	LastCleanupTime  time.Duration             // Duration of the last auto-cleanup cycle
+}
+
+// Requests returns the number of lookups
+func (s Stats) Requests() uint64 {
+	return s.Hits + s.Misses
+}
+
+// HitRatio returns the ratio of lookups that found an item, 1 if there was no lookup
+func (s Stats) HitRatio() float64 {
+	if s.Requests() == 0 {
+		return 1
+	}
+	return float64(s.Hits) / float64(s.Requests())
+}
+
+// AverageLoadTime returns the average time spent in a loader call
+func (s Stats) AverageLoadTime() time.Duration {
+	if n := s.Loads + s.LoadFailures; n > 0 {
+		return s.TotalLoadTime / time.Duration(n)
+	}
+	return 0
+}
+
+// statsRecorder counts the cache events, a nil recorder records nothing
+type statsRecorder struct {
+	hits             atomic.Uint64
+	misses           atomic.Uint64
+	loads            atomic.Uint64
+	loadFailures     atomic.Uint64
+	totalLoadTime    atomic.Int64
+	evictions        [Cleared + 1]atomic.Uint64
+	expirations      atomic.Uint64
+	cleanupCycles    atomic.Uint64
+	totalCleanupTime atomic.Int64
+	lastCleanupTime  atomic.Int64
+}
+
+func (s *statsRecorder) recordLookup(found bool) {
+	if s == nil {
+		return
+	}
+	if found {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+func (s *statsRecorder) recordLoad(d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.loadFailures.Add(1)
+	} else {
+		s.loads.Add(1)
+	}
+	s.totalLoadTime.Add(int64(d))
+}
+
+func (s *statsRecorder) recordEviction(reason EvictionReason) {
+	if s == nil {
+		return
+	}
+	s.evictions[reason].Add(1)
+}
+
+func (s *statsRecorder) recordExpirations(n int) {
+	if s == nil {
+		return
+	}
+	s.expirations.Add(uint64(n))
+}
+
+func (s *statsRecorder) recordCleanup(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.cleanupCycles.Add(1)
+	s.totalCleanupTime.Add(int64(d))
+	s.lastCleanupTime.Store(int64(d))
+}
+
+func (s *statsRecorder) snapshot() (out Stats) {
+	if s == nil {
+		return
+	}
+	out.Hits = s.hits.Load()
+	out.Misses = s.misses.Load()
+	out.Loads = s.loads.Load()
+	out.LoadFailures = s.loadFailures.Load()
+	out.TotalLoadTime = time.Duration(s.totalLoadTime.Load())
+	out.Evictions = make(map[EvictionReason]uint64)
+	for reason := Expired; reason <= Cleared; reason++ {
+		if n := s.evictions[reason].Load(); n > 0 {
+			out.Evictions[reason] = n
+		}
+	}
+	out.Expirations = s.expirations.Load()
+	out.CleanupCycles = s.cleanupCycles.Load()
+	out.TotalCleanupTime = time.Duration(s.totalCleanupTime.Load())
+	out.LastCleanupTime = time.Duration(s.lastCleanupTime.Load())
+	return
+}
+
+// timeLoad calls the loader function and records its outcome
+func (c *Cache[K, V]) timeLoad(fn func() (V, error)) (V, error) {
+	start := c.now()
+	value, err := fn()
+	c.stats.recordLoad(c.clock.Since(start), err)
+	return value, err
+}
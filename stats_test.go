@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), MaxItems(2), RecordStats)
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	_, _ = c.Get("key1")
+	_, _ = c.Get("key1")
+	_, _ = c.Get("missing")
+	_, _ = c.Take("key2")
+	c.Set("key3", 3)
+	c.Set("key4", 4)
+	c.Set("key4", 44)
+	loader := func(ctx context.Context) (int, error) {
+		clock.Advance(time.Second)
+		return 5, nil
+	}
+	_, _ = c.GetOrLoad(context.Background(), "key5", loader)
+	_, _ = c.GetOrLoad(context.Background(), "key6", func(ctx context.Context) (int, error) {
+		return 0, errors.New("some error")
+	})
+	clock.Advance(2 * time.Minute)
+	c.DeleteExpired()
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, 0.5, stats.HitRatio())
+	assert.Equal(t, uint64(1), stats.Loads)
+	assert.Equal(t, uint64(1), stats.LoadFailures)
+	assert.Equal(t, time.Second, stats.TotalLoadTime)
+	assert.Equal(t, 500*time.Millisecond, stats.AverageLoadTime())
+	assert.Equal(t, map[EvictionReason]uint64{Deleted: 1, Replaced: 1, Capacity: 2, Expired: 2}, stats.Evictions)
+	assert.Equal(t, uint64(2), stats.Expirations)
+}
+
+func TestStatsCleanup(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), RecordStats)
+	clock.BlockUntil(1)
+	c.Set("key1", 1)
+	clock.Advance(11 * time.Minute)
+	<-c.cleanupEventsCh
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.CleanupCycles)
+	assert.Equal(t, uint64(1), stats.Expirations)
+}
+
+func TestStatsCleared(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	c := New[int](time.Minute, WithClock(clock), RecordStats)
+	c.Set("key1", 1)
+	c.Set("key2", 2)
+	c.Set("key3", 3, ExpireIn(time.Second))
+	clock.Advance(2 * time.Second)
+	c.DeleteAll()
+	assert.Equal(t, map[EvictionReason]uint64{Cleared: 2, Expired: 1}, c.Stats().Evictions)
+}
+
+func TestStatsDisabled(t *testing.T) {
+	c := New[int](time.Minute)
+	c.Set("key1", 1)
+	_, _ = c.Get("key1")
+	stats := c.Stats()
+	assert.Equal(t, uint64(0), stats.Hits)
+	assert.Equal(t, float64(1), stats.HitRatio())
+	assert.Equal(t, time.Duration(0), stats.AverageLoadTime())
+}
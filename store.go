@@ -0,0 +1,73 @@
+package cache
+
+// Store holds the items of a cache (or of one of its shards, see Shards).
+// The cache protects every store with a lock: the methods that modify the store are never called concurrently
+// with any other method, while Load, Range and Len may be called concurrently with each other.
+// The store must give back the items as they were given. A store that keeps the items in memory can keep them as
+// they are, while a store that serializes them can encode their ItemState and rebuild them with NewItem.
+type Store[K comparable, V any] interface {
+	// Load returns the item associated to the key
+	Load(k K) (item Item[V], found bool)
+	// Store associates the item to the key, replacing the previous item if any
+	Store(k K, item Item[V])
+	// Delete removes the item associated to the key, if any
+	Delete(k K)
+	// Range calls fn for every item until fn returns false. fn may delete the item it is given.
+	// The batched cleanup (see CleanupBatch) pauses Range between two calls of fn while the store is modified,
+	// like a range over a map: an item deleted meanwhile is not given to fn, and an item stored meanwhile may be.
+	Range(fn func(k K, item Item[V]) bool)
+	// Len returns the number of items in the store
+	Len() int
+	// Clear removes all the items
+	Clear()
+	// Compute calls fn with the item associated to the key, and performs the returned action
+	Compute(k K, fn func(current Item[V], found bool) (Item[V], Action))
+}
+
+// mapStore is the default Store, backed by a hashmap
+type mapStore[K comparable, V any] struct {
+	m map[K]Item[V]
+}
+
+func newMapStore[K comparable, V any]() Store[K, V] {
+	return &mapStore[K, V]{m: make(map[K]Item[V])}
+}
+
+func (s *mapStore[K, V]) Load(k K) (item Item[V], found bool) {
+	item, found = s.m[k]
+	return
+}
+
+func (s *mapStore[K, V]) Store(k K, item Item[V]) {
+	s.m[k] = item
+}
+
+func (s *mapStore[K, V]) Delete(k K) {
+	delete(s.m, k)
+}
+
+func (s *mapStore[K, V]) Range(fn func(k K, item Item[V]) bool) {
+	for k, item := range s.m {
+		if !fn(k, item) {
+			return
+		}
+	}
+}
+
+func (s *mapStore[K, V]) Len() int {
+	return len(s.m)
+}
+
+func (s *mapStore[K, V]) Clear() {
+	clear(s.m)
+}
+
+func (s *mapStore[K, V]) Compute(k K, fn func(current Item[V], found bool) (Item[V], Action)) {
+	current, found := s.m[k]
+	switch next, action := fn(current, found); action {
+	case ComputeSet:
+		s.m[k] = next
+	case ComputeDelete:
+		delete(s.m, k)
+	}
+}
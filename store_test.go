@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"encoding/json"
+	"github.com/alaingilbert/clockwork"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// countingStore wraps the default store and counts the calls that modify it, and the items it iterates over
+type countingStore[K comparable, V any] struct {
+	*mapStore[K, V]
+	writes  int
+	visited int
+}
+
+func (s *countingStore[K, V]) Range(fn func(k K, item Item[V]) bool) {
+	s.mapStore.Range(func(k K, item Item[V]) bool {
+		s.visited++
+		return fn(k, item)
+	})
+}
+
+func (s *countingStore[K, V]) Store(k K, item Item[V]) {
+	s.writes++
+	s.mapStore.Store(k, item)
+}
+
+func (s *countingStore[K, V]) Compute(k K, fn func(current Item[V], found bool) (Item[V], Action)) {
+	s.writes++
+	s.mapStore.Compute(k, fn)
+}
+
+func TestWithStore(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	var stores []*countingStore[string, int]
+	newStore := func() Store[string, int] {
+		s := &countingStore[string, int]{mapStore: newMapStore[string, int]().(*mapStore[string, int])}
+		stores = append(stores, s)
+		return s
+	}
+	c := New[int](time.Minute, WithClock(clock), WithStore(newStore), Shards(2))
+	assert.Len(t, stores, 2)
+	c.Set("key1", 1)
+	c.Set("key2", 2, NoExpire)
+	_, err := Increment(c, "key1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stores[0].writes+stores[1].writes)
+	assert.Equal(t, map[string]int{"key1": 2, "key2": 2}, itemValues(c.Items()))
+	clock.Advance(2 * time.Minute)
+	c.DeleteExpired()
+	assert.Equal(t, 1, c.Len())
+	c.DeleteAll()
+	assert.Equal(t, 0, stores[0].Len()+stores[1].Len())
+}
+
+func TestWithStoreTypeMismatch(t *testing.T) {
+	assert.Panics(t, func() { New[int](time.Minute, WithStore(newMapStore[string, string])) })
+}
+
+// jsonStore serializes the items it is given, and rebuilds them when they are loaded
+type jsonStore[K comparable, V any] struct {
+	m map[K][]byte
+}
+
+func (s *jsonStore[K, V]) encode(item Item[V]) []byte {
+	data, err := json.Marshal(item.State())
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func (s *jsonStore[K, V]) decode(data []byte) Item[V] {
+	var state ItemState[V]
+	if err := json.Unmarshal(data, &state); err != nil {
+		panic(err)
+	}
+	return NewItem(state)
+}
+
+func (s *jsonStore[K, V]) Load(k K) (item Item[V], found bool) {
+	data, found := s.m[k]
+	if !found {
+		return item, false
+	}
+	return s.decode(data), true
+}
+
+func (s *jsonStore[K, V]) Store(k K, item Item[V]) { s.m[k] = s.encode(item) }
+func (s *jsonStore[K, V]) Delete(k K)              { delete(s.m, k) }
+func (s *jsonStore[K, V]) Len() int                { return len(s.m) }
+func (s *jsonStore[K, V]) Clear()                  { clear(s.m) }
+
+func (s *jsonStore[K, V]) Range(fn func(k K, item Item[V]) bool) {
+	for k, data := range s.m {
+		if !fn(k, s.decode(data)) {
+			return
+		}
+	}
+}
+
+func (s *jsonStore[K, V]) Compute(k K, fn func(current Item[V], found bool) (Item[V], Action)) {
+	current, found := s.Load(k)
+	switch next, action := fn(current, found); action {
+	case ComputeSet:
+		s.Store(k, next)
+	case ComputeDelete:
+		s.Delete(k)
+	}
+}
+
+func TestWithStoreSerialized(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	newStore := func() Store[string, int] { return &jsonStore[string, int]{m: make(map[string][]byte)} }
+	c := New[int](time.Minute, WithClock(clock), WithStore(newStore), Weigher(func(k string, v int) int64 { return int64(v) }))
+	c.Set("key1", 1)
+	c.Set("key2", 2, Sliding(time.Minute))
+	_, version, found := c.GetWithVersion("key1")
+	assert.True(t, found)
+	assert.NoError(t, c.SetIfVersion("key1", 3, version))
+	assert.ErrorIs(t, c.SetIfVersion("key1", 4, version), ErrVersionMismatch)
+	item := c.Items()["key1"]
+	assert.Equal(t, 3, item.Value())
+	assert.Equal(t, int64(3), item.Cost())
+	assert.Equal(t, clock.Now().Add(time.Minute).UnixNano(), item.Expiration().UnixNano())
+	// The sliding expiration survives the serialization
+	clock.Advance(40 * time.Second)
+	_, _ = c.Get("key2")
+	clock.Advance(40 * time.Second)
+	v, found := c.Get("key2")
+	assert.True(t, found)
+	assert.Equal(t, 2, v)
+	_, found = c.Get("key1")
+	assert.False(t, found)
+}
+
+func TestItemState(t *testing.T) {
+	item := Item[string]{value: "val", expiration: 42, cost: 3, created: 7, version: 9, ttl: 35, sliding: true}
+	assert.Equal(t, item, NewItem(item.State()))
+	assert.Equal(t, ItemState[string]{Value: "val", Expiration: 42, Cost: 3, Created: 7, Version: 9, TTL: 35, Sliding: true}, item.State())
+}
+
+func TestMapStore(t *testing.T) {
+	s := newMapStore[string, int]()
+	s.Store("key1", Item[int]{value: 1})
+	s.Store("key2", Item[int]{value: 2})
+	s.Compute("key1", func(current Item[int], found bool) (Item[int], Action) {
+		assert.True(t, found)
+		current.value++
+		return current, ComputeSet
+	})
+	s.Compute("key2", func(Item[int], bool) (Item[int], Action) { return Item[int]{}, ComputeDelete })
+	s.Compute("key3", func(current Item[int], found bool) (Item[int], Action) {
+		assert.False(t, found)
+		return Item[int]{value: 3}, ComputeKeep
+	})
+	item, found := s.Load("key1")
+	assert.True(t, found)
+	assert.Equal(t, 2, item.value)
+	assert.Equal(t, 1, s.Len())
+	s.Range(func(k string, _ Item[int]) bool {
+		s.Delete(k)
+		return true
+	})
+	assert.Equal(t, 0, s.Len())
+	s.Store("key1", Item[int]{value: 1})
+	s.Clear()
+	assert.Equal(t, 0, s.Len())
+}
+
+func itemValues[K comparable, V any](items map[K]Item[V]) map[K]V {
+	out := make(map[K]V, len(items))
+	for k, item := range items {
+		out[k] = item.Value()
+	}
+	return out
+}